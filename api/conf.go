@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"github.com/go-resty/resty/v2"
 	log "github.com/sirupsen/logrus"
 	"github.com/sn-edit/sn-edit/conf"
@@ -11,41 +12,92 @@ import (
 // load the rest credentials like username and password from the config file
 // we have additional masking for password field, we need to handle this
 func loadCredentials() (string, string) {
-	var err error
 	config := conf.GetConfig()
 
 	username := config.GetString("app.core.rest.user")
-	passwordCredential := config.GetString("app.core.rest.password")
+	passwordCredential := loadSecret("app.core.rest.password", "app.core.rest.masked")
+
+	return username, passwordCredential
+}
+
+// loadSecret returns the secret stored in the config file under the key, a secret which is not
+// masked yet (the masked key is false) is masked with the xor key and written back to the config file
+func loadSecret(key string, maskedKey string) string {
+	config := conf.GetConfig()
+
+	secret := config.GetString(key)
 	xorKey := config.GetString("app.core.rest.xor_key")
-	isMasked := config.GetBool("app.core.rest.masked")
+	isMasked := config.GetBool(maskedKey)
 
 	if isMasked == true {
-		passwordCredential = xor.EncryptDecrypt(passwordCredential, xorKey)
+		return xor.EncryptDecrypt(secret, xorKey)
 	}
 
-	if isMasked == false {
-		xorPassword := xor.EncryptDecrypt(config.GetString("app.core.rest.password"), config.GetString("app.core.rest.xor_key"))
-		config.Set("app.core.rest.password", xorPassword)
-		config.Set("app.core.rest.masked", true)
-		err = config.WriteConfig()
+	config.Set(key, xor.EncryptDecrypt(secret, xorKey))
+	config.Set(maskedKey, true)
+	err := config.WriteConfig()
+
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("There was a problem while rewriting the config file! Check the permissions please!")
+		os.Exit(1)
+	}
+
+	return secret
+}
+
+// credentialSource provides the token sent with every request instead of the basic auth
+type credentialSource interface {
+	// Token returns the current token, getting a new one if there is none
+	Token(ctx context.Context) (string, error)
+	// invalidate drops the token the instance refused, the next request gets a new one
+	invalidate(token string)
+}
+
+var (
+	// the source of the token sent with the requests, nil for basic auth
+	credentials credentialSource
+	// the header carrying the token and the prefix of its value
+	credentialHeader string
+	credentialPrefix string
+)
+
+// useCredentials sets the token of the source in the header of every request of the client
+func useCredentials(client *resty.Client, source credentialSource, header string, prefix string) {
+	credentials, credentialHeader, credentialPrefix = source, header, prefix
+
+	client.OnBeforeRequest(func(c *resty.Client, r *resty.Request) error {
+		token, err := credentials.Token(r.Context())
 
 		if err != nil {
-			log.WithFields(log.Fields{"error": err}).Error("There was a problem while rewriting the config file! Check the permissions please!")
-			os.Exit(1)
+			return err
 		}
-	}
 
-	return username, passwordCredential
+		r.SetHeader(credentialHeader, credentialPrefix+token)
+
+		return nil
+	})
 }
 
 func SetupClient() {
 	// Create a Resty Client
 	client := resty.New()
-	// load the credentials from the config file
-	username, password := loadCredentials()
-	// set basic auth, so every request using this client
-	// will have the username and password set
-	client.SetBasicAuth(username, password)
+
+	switch conf.GetConfig().GetString("app.core.rest.auth") {
+	case conf.AuthOAuth:
+		// the access token is requested from the instance when it is missing or expires
+		useCredentials(client, newTokenSource(), "Authorization", "Bearer ")
+	case conf.AuthAPIKey:
+		useCredentials(client, newConfiguredToken(), "x-sn-apikey", "")
+	case conf.AuthBearer:
+		useCredentials(client, newConfiguredToken(), "Authorization", "Bearer ")
+	default:
+		// load the credentials from the config file
+		username, password := loadCredentials()
+		// set basic auth, so every request using this client
+		// will have the username and password set
+		client.SetBasicAuth(username, password)
+	}
+
 	// we shall communicate with JSON if not stated otherwise
 	client.SetHeader("Content-Type", "application/json; charset=utf-8").SetHeader("Accept", "application/json")
 	// set the configured client to re-use this throughout the app
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// the kinds of the errors returned by the instance
+const (
+	ErrorUnauthorized     = "unauthorized"
+	ErrorACLDenied        = "acl_denied"
+	ErrorNotFound         = "not_found"
+	ErrorInvalidUpdateSet = "invalid_update_set"
+	ErrorUnexpected       = "unexpected_status_code"
+)
+
+// Error is a request the instance answered with an unexpected status code,
+// the message and the detail are taken from the error payload of the instance
+type Error struct {
+	Kind       string `json:"kind"`
+	StatusCode int    `json:"status_code"`
+	Message    string `json:"message"`
+	Detail     string `json:"detail"`
+	URL        string `json:"url"`
+}
+
+// Error returns the kind of the error with the status code and the message of the instance
+func (e *Error) Error() string {
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("%s (%d)", e.Kind, e.StatusCode)
+	}
+
+	return fmt.Sprintf("%s (%d): %s", e.Kind, e.StatusCode, e.Message)
+}
+
+// Fields returns the details of the error for the log output
+func (e *Error) Fields() log.Fields {
+	return log.Fields{"status_code": e.StatusCode, "message": e.Message, "detail": e.Detail, "url": e.URL}
+}
+
+// ErrorKind returns the kind of an error of the instance, empty for any other error
+func ErrorKind(err error) string {
+	if apiError, ok := err.(*Error); ok {
+		return apiError.Kind
+	}
+
+	return ""
+}
+
+// newError reads the error payload ({"error":{"message":...,"detail":...},"status":"failure"}) of the response
+func newError(resp *resty.Response, url string) *Error {
+	var payload struct {
+		Error struct {
+			Message string `json:"message"`
+			Detail  string `json:"detail"`
+		} `json:"error"`
+	}
+
+	// other payloads (like the html page of a proxy) leave the message empty
+	_ = json.Unmarshal(resp.Body(), &payload)
+
+	apiError := &Error{Kind: ErrorUnexpected, StatusCode: resp.StatusCode(), Message: payload.Error.Message, Detail: payload.Error.Detail, URL: url}
+
+	switch resp.StatusCode() {
+	case http.StatusUnauthorized:
+		apiError.Kind = ErrorUnauthorized
+	case http.StatusForbidden:
+		apiError.Kind = ErrorACLDenied
+	case http.StatusNotFound:
+		apiError.Kind = ErrorNotFound
+	}
+
+	// the instance refuses writes into update sets which are not in progress or of another scope
+	if resp.StatusCode() >= 400 && resp.StatusCode() < 500 && strings.Contains(strings.ToLower(apiError.Message+" "+apiError.Detail), "update set") {
+		apiError.Kind = ErrorInvalidUpdateSet
+	}
+
+	return apiError
+}
+
+// checkStatus returns an error if the instance did not answer with one of the expected status codes
+func checkStatus(resp *resty.Response, url string, expected ...int) error {
+	for _, statusCode := range expected {
+		if resp.StatusCode() == statusCode {
+			return nil
+		}
+	}
+
+	// the caller logs the error with its details
+	return newError(resp, url)
+}
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/go-resty/resty/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db/tokencache"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the access token is renewed this long before it expires, so it does not expire during a request
+const expiryMargin = 30 * time.Second
+
+// the lifespan of the access tokens if the instance does not tell it (the default of the instance)
+const defaultTokenLifespan = 30 * time.Minute
+
+// oauthToken is a token received from the instance
+type oauthToken struct {
+	AccessToken  string
+	RefreshToken string
+	// unix time the access token expires at
+	ExpiresAt int64
+}
+
+// tokenSource requests the access tokens from the token endpoint of the instance,
+// the tokens are kept for the parallel requests and cached encrypted in the database
+type tokenSource struct {
+	mutex        sync.Mutex
+	tokenURL     string
+	grantType    string
+	clientID     string
+	clientSecret string
+	username     string
+	password     string
+	token        oauthToken
+	loaded       bool
+}
+
+// tokenResponse is the answer of the token endpoint
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// newTokenSource reads the OAuth configuration, the token endpoint of the instance
+// (/oauth_token.do) and the password grant are used if they are not configured
+func newTokenSource() *tokenSource {
+	config := conf.GetConfig()
+
+	source := &tokenSource{
+		tokenURL:     config.GetString("app.core.rest.oauth.token_url"),
+		grantType:    config.GetString("app.core.rest.oauth.grant_type"),
+		clientID:     config.GetString("app.core.rest.oauth.client_id"),
+		clientSecret: loadSecret("app.core.rest.oauth.client_secret", "app.core.rest.oauth.masked"),
+	}
+
+	if len(source.tokenURL) == 0 {
+		source.tokenURL = strings.TrimSuffix(config.GetString("app.core.rest.url"), "/") + "/oauth_token.do"
+	}
+
+	if len(source.grantType) == 0 {
+		source.grantType = conf.GrantPassword
+	}
+
+	if source.grantType == conf.GrantPassword {
+		source.username, source.password = loadCredentials()
+	}
+
+	return source
+}
+
+// Token returns a valid access token, a new one is requested with the refresh token
+// or the configured grant if there is none or it expires soon
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// the token of the previous run
+	if !s.loaded {
+		s.loaded = true
+		s.token = loadToken(s.cacheKey())
+	}
+
+	if len(s.token.AccessToken) > 0 && time.Now().Add(expiryMargin).Before(time.Unix(s.token.ExpiresAt, 0)) {
+		return s.token.AccessToken, nil
+	}
+
+	// the refresh token saves sending the credentials again, the grant is used if it expired as well
+	if len(s.token.RefreshToken) > 0 {
+		token, err := s.requestToken(ctx, map[string]string{"grant_type": "refresh_token", "refresh_token": s.token.RefreshToken})
+
+		if err == nil {
+			return s.setToken(token), nil
+		}
+
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		log.WithFields(log.Fields{"error": err}).Debug("The refresh token was refused, requesting a new token!")
+	}
+
+	form := map[string]string{"grant_type": s.grantType}
+
+	if s.grantType == conf.GrantPassword {
+		form["username"] = s.username
+		form["password"] = s.password
+	}
+
+	token, err := s.requestToken(ctx, form)
+
+	if err != nil {
+		return "", err
+	}
+
+	return s.setToken(token), nil
+}
+
+// invalidate drops the access token the instance refused (revoked before it expired), the next request gets a new one
+func (s *tokenSource) invalidate(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// a parallel request could have renewed it already
+	if token == s.token.AccessToken {
+		s.token.AccessToken = ""
+		s.token.ExpiresAt = 0
+	}
+}
+
+// setToken keeps the token and caches it in the database
+func (s *tokenSource) setToken(token oauthToken) string {
+	// the instance does not always issue a new refresh token
+	if len(token.RefreshToken) == 0 {
+		token.RefreshToken = s.token.RefreshToken
+	}
+
+	s.token = token
+	saveToken(s.cacheKey(), token)
+
+	return token.AccessToken
+}
+
+// cacheKey identifies the tokens of the configured endpoint, client and user in the database
+func (s *tokenSource) cacheKey() string {
+	return strings.Join([]string{s.tokenURL, s.grantType, s.clientID, s.username}, " ")
+}
+
+// requestToken posts the grant to the token endpoint
+func (s *tokenSource) requestToken(ctx context.Context, form map[string]string) (oauthToken, error) {
+	form["client_id"] = s.clientID
+	form["client_secret"] = s.clientSecret
+
+	resp, err := resty.New().R().SetContext(ctx).SetHeader("Accept", "application/json").SetFormData(form).Post(s.tokenURL)
+
+	if err != nil {
+		return oauthToken{}, err
+	}
+
+	var payload tokenResponse
+
+	// other payloads (like the html page of a proxy) leave the token empty
+	_ = json.Unmarshal(resp.Body(), &payload)
+
+	if resp.StatusCode() != http.StatusOK || len(payload.AccessToken) == 0 {
+		return oauthToken{}, &Error{Kind: ErrorUnauthorized, StatusCode: resp.StatusCode(), Message: payload.Error, Detail: payload.ErrorDescription, URL: s.tokenURL}
+	}
+
+	lifespan := time.Duration(payload.ExpiresIn) * time.Second
+
+	if lifespan <= 0 {
+		lifespan = defaultTokenLifespan
+	}
+
+	log.WithFields(log.Fields{"grant_type": form["grant_type"], "expires_in": lifespan.String()}).Debug("Received a new OAuth token from the instance!")
+
+	return oauthToken{AccessToken: payload.AccessToken, RefreshToken: payload.RefreshToken, ExpiresAt: time.Now().Add(lifespan).Unix()}, nil
+}
+
+// loadToken reads the cached token from the database, a token which can not be decrypted (the xor key changed) is ignored
+func loadToken(key string) oauthToken {
+	found, cached := tokencache.QueryToken(key)
+
+	if !found {
+		return oauthToken{}
+	}
+
+	accessToken, err := decryptToken(cached.AccessToken)
+
+	if err != nil {
+		log.WithFields(log.Fields{"warn": err}).Debug("The cached OAuth token could not be decrypted!")
+		return oauthToken{}
+	}
+
+	refreshToken, err := decryptToken(cached.RefreshToken)
+
+	if err != nil {
+		log.WithFields(log.Fields{"warn": err}).Debug("The cached OAuth token could not be decrypted!")
+		return oauthToken{}
+	}
+
+	return oauthToken{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresAt: cached.ExpiresAt}
+}
+
+// saveToken caches the token encrypted in the database, the next runs do not have to request one
+func saveToken(key string, token oauthToken) {
+	accessToken, err := encryptToken(token.AccessToken)
+	refreshToken := ""
+
+	if err == nil {
+		refreshToken, err = encryptToken(token.RefreshToken)
+	}
+
+	if err != nil {
+		conf.Err("The OAuth token could not be encrypted!", log.Fields{"error": err}, false)
+		return
+	}
+
+	// the token is requested again on the next run
+	_ = tokencache.WriteToken(key, tokencache.Token{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresAt: token.ExpiresAt})
+}
+
+// tokenCipher is the AES-GCM cipher of the cached tokens, the key is derived from the xor key of the config file
+func tokenCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(conf.GetConfig().GetString("app.core.rest.xor_key")))
+	block, err := aes.NewCipher(key[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptToken encrypts the token, prefixing it with the nonce
+func encryptToken(token string) (string, error) {
+	if len(token) == 0 {
+		return "", nil
+	}
+
+	gcm, err := tokenCipher()
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(token), nil)), nil
+}
+
+// decryptToken decrypts a token encrypted by encryptToken
+func decryptToken(encrypted string) (string, error) {
+	if len(encrypted) == 0 {
+		return "", nil
+	}
+
+	gcm, err := tokenCipher()
+
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid_token")
+	}
+
+	token, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(token), nil
+}
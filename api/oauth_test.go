@@ -0,0 +1,389 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db/tokencache"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// oauthServer is a token endpoint (/oauth_token.do) and an api (/api) accepting the issued access tokens
+type oauthServer struct {
+	*httptest.Server
+	mutex sync.Mutex
+	// the lifespan of the issued access tokens in seconds
+	expiresIn int
+	// refresh tokens are refused, like after they expired
+	refuseRefresh bool
+	// every access token is refused by the api
+	refuseAPI     bool
+	grants        map[string]int
+	apiRequests   int
+	issued        int
+	accessTokens  map[string]bool
+	refreshTokens map[string]bool
+}
+
+func newOAuthServer() *oauthServer {
+	server := &oauthServer{expiresIn: 1800, grants: map[string]int{}, accessTokens: map[string]bool{}, refreshTokens: map[string]bool{}}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+
+	return server
+}
+
+func (s *oauthServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Path == "/api" {
+		s.apiRequests++
+
+		if s.refuseAPI || !s.accessTokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"User Not Authenticated"},"status":"failure"}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"result":[]}`))
+		return
+	}
+
+	_ = r.ParseForm()
+	grantType := r.PostForm.Get("grant_type")
+	s.grants[grantType]++
+
+	valid := r.PostForm.Get("client_id") == "client" && r.PostForm.Get("client_secret") == "secret"
+
+	switch grantType {
+	case "password":
+		valid = valid && r.PostForm.Get("username") == "admin" && r.PostForm.Get("password") == "password"
+	case "refresh_token":
+		valid = valid && !s.refuseRefresh && s.refreshTokens[r.PostForm.Get("refresh_token")]
+	case "client_credentials":
+		// the client itself is the user, no refresh token is issued
+	default:
+		valid = false
+	}
+
+	if !valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"access_denied","error_description":"access_denied"}`))
+		return
+	}
+
+	s.issued++
+	accessToken := fmt.Sprintf("access-%d", s.issued)
+	s.accessTokens[accessToken] = true
+	payload := map[string]interface{}{"access_token": accessToken, "expires_in": s.expiresIn}
+
+	if grantType != "client_credentials" {
+		refreshToken := fmt.Sprintf("refresh-%d", s.issued)
+		s.refreshTokens[refreshToken] = true
+		payload["refresh_token"] = refreshToken
+	}
+
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// revoke refuses every access token issued so far
+func (s *oauthServer) revoke() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.accessTokens = map[string]bool{}
+}
+
+func (s *oauthServer) grantCount(grantType string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.grants[grantType]
+}
+
+// setupTokenCache configures a database with the token cache in a temporary directory,
+// the returned function removes it
+func setupTokenCache(t *testing.T, xorKey string) func() {
+	directory, err := ioutil.TempDir("", "sn-edit-oauth")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the initialisation of the database is written to the config file
+	config := viper.New()
+	config.SetConfigFile(filepath.Join(directory, "sn-edit.yaml"))
+	config.Set("app.core.db.path", filepath.Join(directory, "sn-edit.db"))
+	config.Set("app.core.rest.xor_key", xorKey)
+	config.Set("app.core.rest.retry.attempts", 1)
+	conf.SetConfig(config)
+
+	conf.ConnectDB()
+	conf.BuildTables()
+	conf.MigrateTables()
+
+	return func() {
+		_ = conf.GetDB().Close()
+		_ = os.RemoveAll(directory)
+	}
+}
+
+func newTestTokenSource(server *oauthServer) *tokenSource {
+	return &tokenSource{tokenURL: server.URL + "/oauth_token.do", grantType: conf.GrantPassword, clientID: "client", clientSecret: "secret", username: "admin", password: "password"}
+}
+
+func TestTokenPasswordGrant(t *testing.T) {
+	defer setupTokenCache(t, "key")()
+	server := newOAuthServer()
+	defer server.Close()
+
+	source := newTestTokenSource(server)
+
+	for i := 0; i < 3; i++ {
+		token, err := source.Token(context.Background())
+
+		if err != nil || token != "access-1" {
+			t.Fatalf("Token() = %q, %v, want %q", token, err, "access-1")
+		}
+	}
+
+	if grants := server.grantCount("password"); grants != 1 {
+		t.Errorf("the password grant was requested %d times, want 1", grants)
+	}
+}
+
+func TestTokenWrongCredentials(t *testing.T) {
+	defer setupTokenCache(t, "key")()
+	server := newOAuthServer()
+	defer server.Close()
+
+	source := newTestTokenSource(server)
+	source.password = "wrong"
+
+	_, err := source.Token(context.Background())
+
+	if ErrorKind(err) != ErrorUnauthorized {
+		t.Errorf("Token() error = %v, want the %s kind", err, ErrorUnauthorized)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	defer setupTokenCache(t, "key")()
+	server := newOAuthServer()
+	defer server.Close()
+
+	// the tokens expire within the margin, they are renewed on every call
+	server.expiresIn = 1
+	source := newTestTokenSource(server)
+
+	for i, want := range []string{"access-1", "access-2", "access-3"} {
+		token, err := source.Token(context.Background())
+
+		if err != nil || token != want {
+			t.Fatalf("Token() call %d = %q, %v, want %q", i+1, token, err, want)
+		}
+	}
+
+	if password, refresh := server.grantCount("password"), server.grantCount("refresh_token"); password != 1 || refresh != 2 {
+		t.Errorf("got %d password and %d refresh grants, want 1 and 2", password, refresh)
+	}
+}
+
+func TestTokenRefreshRefused(t *testing.T) {
+	defer setupTokenCache(t, "key")()
+	server := newOAuthServer()
+	defer server.Close()
+
+	server.expiresIn = 1
+	server.refuseRefresh = true
+	source := newTestTokenSource(server)
+
+	for i, want := range []string{"access-1", "access-2"} {
+		token, err := source.Token(context.Background())
+
+		if err != nil || token != want {
+			t.Fatalf("Token() call %d = %q, %v, want %q", i+1, token, err, want)
+		}
+	}
+
+	if password, refresh := server.grantCount("password"), server.grantCount("refresh_token"); password != 2 || refresh != 1 {
+		t.Errorf("got %d password and %d refresh grants, want 2 and 1", password, refresh)
+	}
+}
+
+func TestTokenClientCredentials(t *testing.T) {
+	defer setupTokenCache(t, "key")()
+	server := newOAuthServer()
+	defer server.Close()
+
+	newSource := func() *tokenSource {
+		return &tokenSource{tokenURL: server.URL + "/oauth_token.do", grantType: conf.GrantClientCredentials, clientID: "client", clientSecret: "secret"}
+	}
+
+	source := newSource()
+
+	for i := 0; i < 2; i++ {
+		if token, err := source.Token(context.Background()); err != nil || token != "access-1" {
+			t.Fatalf("Token() = %q, %v, want %q", token, err, "access-1")
+		}
+	}
+
+	// the next run uses the cached token
+	if token, err := newSource().Token(context.Background()); err != nil || token != "access-1" {
+		t.Errorf("Token() of the next run = %q, %v, want the cached %q", token, err, "access-1")
+	}
+
+	// without a refresh token the grant is requested again when the token expires
+	server.expiresIn = 1
+	source.token.ExpiresAt = time.Now().Unix()
+
+	for _, want := range []string{"access-2", "access-3"} {
+		if token, err := source.Token(context.Background()); err != nil || token != want {
+			t.Fatalf("Token() after the expiry = %q, %v, want %q", token, err, want)
+		}
+	}
+
+	if grants, refresh := server.grantCount("client_credentials"), server.grantCount("refresh_token"); grants != 3 || refresh != 0 {
+		t.Errorf("got %d client credentials and %d refresh grants, want 3 and 0", grants, refresh)
+	}
+}
+
+func TestTokenInvalidatedOnUnauthorized(t *testing.T) {
+	defer setupTokenCache(t, "key")()
+	server := newOAuthServer()
+	defer server.Close()
+
+	source := newTestTokenSource(server)
+	client := resty.New()
+	useCredentials(client, source, "Authorization", "Bearer ")
+	conf.SetClient(client)
+	defer func() { credentials = nil }()
+
+	if _, err := Get(context.Background(), server.URL+"/api"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	// the instance revokes the token before it expires, the request gets a new one and is sent again
+	server.revoke()
+
+	if _, err := Get(context.Background(), server.URL+"/api"); err != nil {
+		t.Fatalf("Get() with a revoked token error = %v", err)
+	}
+
+	if server.apiRequests != 3 || server.grantCount("refresh_token") != 1 {
+		t.Errorf("got %d api requests and %d refresh grants, want 3 and 1", server.apiRequests, server.grantCount("refresh_token"))
+	}
+
+	// a refused refresh token falls back to the grant
+	server.refuseRefresh = true
+	server.revoke()
+
+	if err := Delete(context.Background(), server.URL+"/api"); err != nil {
+		t.Fatalf("Delete() with a revoked token error = %v", err)
+	}
+
+	if server.grantCount("password") != 2 {
+		t.Errorf("got %d password grants, want 2", server.grantCount("password"))
+	}
+
+	// a token refused again is not renewed in a loop
+	server.refuseAPI = true
+	requests := server.apiRequests
+	_, err := Get(context.Background(), server.URL+"/api")
+
+	if ErrorKind(err) != ErrorUnauthorized || server.apiRequests != requests+2 {
+		t.Errorf("Get() = %v after %d requests, want the %s kind after 2 requests", err, server.apiRequests-requests, ErrorUnauthorized)
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	defer setupTokenCache(t, "key")()
+	server := newOAuthServer()
+	defer server.Close()
+
+	token, err := newTestTokenSource(server).Token(context.Background())
+
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	// the tokens are stored encrypted
+	found, cached := tokencache.QueryToken(newTestTokenSource(server).cacheKey())
+
+	if !found || len(cached.AccessToken) == 0 || strings.Contains(cached.AccessToken, token) || strings.Contains(cached.RefreshToken, "refresh-1") {
+		t.Fatalf("the cached token %+v is not encrypted", cached)
+	}
+
+	// the next run uses the cached token
+	if cachedToken, err := newTestTokenSource(server).Token(context.Background()); err != nil || cachedToken != token {
+		t.Errorf("Token() of the next run = %q, %v, want the cached %q", cachedToken, err, token)
+	}
+
+	if grants := server.grantCount("password"); grants != 1 {
+		t.Errorf("the password grant was requested %d times, want 1", grants)
+	}
+
+	// a token cached with another xor key can not be decrypted, a new one is requested
+	conf.GetConfig().Set("app.core.rest.xor_key", "other")
+
+	if newToken, err := newTestTokenSource(server).Token(context.Background()); err != nil || newToken != "access-2" {
+		t.Errorf("Token() with another xor key = %q, %v, want %q", newToken, err, "access-2")
+	}
+}
+
+func TestTokenEncryption(t *testing.T) {
+	defer setupTokenCache(t, "key")()
+
+	for _, token := range []string{"", "a", "access-token", strings.Repeat("x", 1000)} {
+		encrypted, err := encryptToken(token)
+
+		if err != nil {
+			t.Fatalf("encryptToken(%q) error = %v", token, err)
+		}
+
+		// a short token could appear in the base64 encoding by chance
+		if len(token) > 4 && strings.Contains(encrypted, token) {
+			t.Errorf("encryptToken(%q) = %q contains the token", token, encrypted)
+		}
+
+		decrypted, err := decryptToken(encrypted)
+
+		if err != nil || decrypted != token {
+			t.Errorf("decryptToken(encryptToken(%q)) = %q, %v", token, decrypted, err)
+		}
+	}
+
+	first, _ := encryptToken("token")
+	second, _ := encryptToken("token")
+
+	if first == second {
+		t.Errorf("encryptToken() returned the same value twice, the nonce is not random")
+	}
+
+	if _, err := decryptToken(first[:len(first)-4] + "AAAA"); err == nil {
+		t.Errorf("decryptToken() of a modified token returned no error")
+	}
+
+	if _, err := decryptToken("AAAA"); err == nil {
+		t.Errorf("decryptToken() of a too short token returned no error")
+	}
+
+	conf.GetConfig().Set("app.core.rest.xor_key", "other")
+
+	if _, err := decryptToken(first); err == nil {
+		t.Errorf("decryptToken() with another xor key returned no error")
+	}
+}
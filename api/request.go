@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"github.com/go-resty/resty/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimeout is the time a request may take if app.core.rest.timeout is not configured
+const defaultTimeout = 60 * time.Second
+
+// retryPolicy is the retry configuration in app.core.rest.retry
+type retryPolicy struct {
+	Attempts int
+	Wait     time.Duration
+	MaxWait  time.Duration
+}
+
+// loadRetryPolicy reads the retry configuration, three attempts waiting one second
+// and at most 30 seconds between them are made if it is not configured
+func loadRetryPolicy() retryPolicy {
+	config := conf.GetConfig()
+	policy := retryPolicy{Attempts: 3, Wait: time.Second, MaxWait: 30 * time.Second}
+
+	if config.IsSet("app.core.rest.retry.attempts") {
+		policy.Attempts = config.GetInt("app.core.rest.retry.attempts")
+	}
+
+	if config.IsSet("app.core.rest.retry.wait") {
+		policy.Wait = config.GetDuration("app.core.rest.retry.wait")
+	}
+
+	if config.IsSet("app.core.rest.retry.max_wait") {
+		policy.MaxWait = config.GetDuration("app.core.rest.retry.max_wait")
+	}
+
+	if policy.Attempts < 1 {
+		policy.Attempts = 1
+	}
+
+	return policy
+}
+
+// RequestTimeout returns the time one attempt of a request may take, zero does not limit it
+func RequestTimeout() time.Duration {
+	config := conf.GetConfig()
+
+	if config.IsSet("app.core.rest.timeout") {
+		return config.GetDuration("app.core.rest.timeout")
+	}
+
+	return defaultTimeout
+}
+
+// send executes the request, retrying it on network errors, when the instance throttles (429)
+// or is not available (502, 503, 504, like a hibernating instance). Requests which are not
+// idempotent (creating an entry) are only retried when the instance refused them (429).
+// Every attempt is limited by the timeout, a cancelled context stops the request and the retries.
+func send(ctx context.Context, method string, url string, body interface{}) (*resty.Response, error) {
+	policy := loadRetryPolicy()
+	idempotent := method != resty.MethodPost
+	timeout := RequestTimeout()
+	renewed := false
+
+	for attempt := 1; ; attempt++ {
+		resp, err := execute(ctx, method, url, body, timeout)
+
+		// the user cancelled the command
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// the instance refused the token before it expired (revoked), a new one is requested once
+		if err == nil && resp.StatusCode() == http.StatusUnauthorized && credentials != nil && !renewed {
+			renewed = true
+			credentials.invalidate(strings.TrimPrefix(resp.Request.Header.Get(credentialHeader), credentialPrefix))
+			log.WithFields(log.Fields{"url": url}).Debug("The token was refused, requesting a new one!")
+			continue
+		}
+
+		retry, retryAfter := shouldRetry(resp, err, idempotent)
+
+		if !retry || attempt >= policy.Attempts {
+			return resp, err
+		}
+
+		wait := backoff(policy, attempt)
+
+		// the instance tells how long to wait
+		if retryAfter > 0 {
+			wait = retryAfter
+
+			if wait > policy.MaxWait {
+				wait = policy.MaxWait
+			}
+		}
+
+		fields := log.Fields{"attempt": attempt, "attempts": policy.Attempts, "wait": wait.String(), "url": url}
+
+		if err != nil {
+			fields["error"] = err
+		} else {
+			fields["status_code"] = resp.StatusCode()
+		}
+
+		log.WithFields(fields).Warn("The request to the instance failed, retrying...")
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// execute makes one attempt of the request, a timeout of zero does not limit it
+func execute(ctx context.Context, method string, url string, body interface{}, timeout time.Duration) (*resty.Response, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	request := conf.GetClient().R().SetContext(ctx)
+
+	if body != nil {
+		request.SetBody(body)
+	}
+
+	return request.Execute(method, url)
+}
+
+// shouldRetry reports if the request should be retried and how long the instance asked to wait (0 if it did not)
+func shouldRetry(resp *resty.Response, err error, idempotent bool) (bool, time.Duration) {
+	// the instance refused the OAuth credentials or the token could not be read
+	if _, ok := err.(*Error); ok || err == errTokenNotFound || err == errTokenCommand {
+		return false, 0
+	}
+
+	if err != nil {
+		return idempotent, 0
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusTooManyRequests:
+		return true, retryAfter(resp)
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent, retryAfter(resp)
+	}
+
+	return false, 0
+}
+
+// retryAfter parses the Retry-After header, given in seconds or as a date
+func retryAfter(resp *resty.Response) time.Duration {
+	value := resp.Header().Get("Retry-After")
+
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// backoff doubles the wait time with every attempt up to the maximum,
+// the jitter keeps parallel requests from retrying at the same time
+func backoff(policy retryPolicy, attempt int) time.Duration {
+	wait := policy.Wait
+
+	for i := 1; i < attempt && wait < policy.MaxWait; i++ {
+		wait *= 2
+	}
+
+	if wait > policy.MaxWait {
+		wait = policy.MaxWait
+	}
+
+	if wait <= 1 {
+		return wait
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)))
+}
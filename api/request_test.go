@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"github.com/go-resty/resty/v2"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/spf13/viper"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setupRetry configures the retries and a plain client for the tests
+func setupRetry(attempts int, wait time.Duration, maxWait time.Duration) {
+	config := viper.New()
+	config.Set("app.core.rest.retry.attempts", attempts)
+	config.Set("app.core.rest.retry.wait", wait)
+	config.Set("app.core.rest.retry.max_wait", maxWait)
+	config.Set("app.core.rest.timeout", 5*time.Second)
+	conf.SetConfig(config)
+	conf.SetClient(resty.New())
+	credentials = nil
+}
+
+// statusServer answers the requests with the given status codes in order (the last one repeated)
+// and the Retry-After header, it counts the requests
+func statusServer(retryAfter string, statusCodes ...int) (*httptest.Server, *int32) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		index := int(atomic.AddInt32(&requests, 1)) - 1
+
+		if index >= len(statusCodes) {
+			index = len(statusCodes) - 1
+		}
+
+		if statusCodes[index] != http.StatusOK && len(retryAfter) > 0 {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+
+		w.WriteHeader(statusCodes[index])
+	}))
+
+	return server, &requests
+}
+
+func TestBackoff(t *testing.T) {
+	policy := retryPolicy{Attempts: 10, Wait: 100 * time.Millisecond, MaxWait: time.Second}
+	limits := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+
+	for i, limit := range limits {
+		attempt := i + 1
+
+		for j := 0; j < 100; j++ {
+			if wait := backoff(policy, attempt); wait < limit/2 || wait >= limit {
+				t.Fatalf("backoff(attempt %d) = %s, want between %s and %s", attempt, wait, limit/2, limit)
+			}
+		}
+	}
+
+	if wait := backoff(retryPolicy{Attempts: 3}, 2); wait != 0 {
+		t.Errorf("backoff() without a wait time = %s, want 0", wait)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"missing", "", 0, 0},
+		{"seconds", "5", 5 * time.Second, 5 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-3", 0, 0},
+		{"invalid", "soon", 0, 0},
+		{"http date", time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{"http date in the past", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), -2 * time.Minute, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+
+			if len(test.value) > 0 {
+				header.Set("Retry-After", test.value)
+			}
+
+			resp := &resty.Response{RawResponse: &http.Response{Header: header}}
+
+			if wait := retryAfter(resp); wait < test.min || wait > test.max {
+				t.Errorf("retryAfter(%q) = %s, want between %s and %s", test.value, wait, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		statusCodes []int
+		requests    int32
+		statusCode  int
+	}{
+		{"success", resty.MethodGet, []int{200}, 1, 200},
+		{"unavailable once", resty.MethodGet, []int{503, 200}, 2, 200},
+		{"throttled twice", resty.MethodGet, []int{429, 429, 200}, 3, 200},
+		{"gateway errors", resty.MethodPut, []int{502, 504, 200}, 3, 200},
+		{"attempts exhausted", resty.MethodGet, []int{503}, 3, 503},
+		{"not found is not retried", resty.MethodGet, []int{404}, 1, 404},
+		{"throttled create is retried", resty.MethodPost, []int{429, 201}, 2, 201},
+		{"unavailable create is not retried", resty.MethodPost, []int{503, 201}, 1, 503},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupRetry(3, time.Millisecond, 10*time.Millisecond)
+			server, requests := statusServer("", test.statusCodes...)
+			defer server.Close()
+
+			resp, err := send(context.Background(), test.method, server.URL, nil)
+
+			if err != nil {
+				t.Fatalf("send() error = %v", err)
+			}
+
+			if resp.StatusCode() != test.statusCode {
+				t.Errorf("send() status code = %d, want %d", resp.StatusCode(), test.statusCode)
+			}
+
+			if got := atomic.LoadInt32(requests); got != test.requests {
+				t.Errorf("send() made %d requests, want %d", got, test.requests)
+			}
+		})
+	}
+}
+
+func TestSendNetworkError(t *testing.T) {
+	setupRetry(2, time.Millisecond, 10*time.Millisecond)
+	server, _ := statusServer("", 200)
+	server.Close()
+
+	if _, err := send(context.Background(), resty.MethodGet, server.URL, nil); err == nil {
+		t.Errorf("send() to a closed server returned no error")
+	}
+}
+
+func TestSendRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		retryAfter string
+		maxWait    time.Duration
+		min        time.Duration
+		max        time.Duration
+	}{
+		{"seconds", http.StatusTooManyRequests, "1", 5 * time.Second, time.Second, 3 * time.Second},
+		{"http date", http.StatusServiceUnavailable, "date", 5 * time.Second, 900 * time.Millisecond, 3 * time.Second},
+		{"limited by the maximum wait", http.StatusServiceUnavailable, "120", 50 * time.Millisecond, 50 * time.Millisecond, time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the date is two seconds ahead when the request is made, one of them could be cut off by the format
+			if test.retryAfter == "date" {
+				test.retryAfter = time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)
+			}
+
+			// the backoff alone would not wait
+			setupRetry(2, time.Nanosecond, test.maxWait)
+			server, requests := statusServer(test.retryAfter, test.statusCode, 200)
+			defer server.Close()
+
+			start := time.Now()
+			resp, err := send(context.Background(), resty.MethodGet, server.URL, nil)
+			elapsed := time.Since(start)
+
+			if err != nil || resp.StatusCode() != 200 || atomic.LoadInt32(requests) != 2 {
+				t.Fatalf("send() = %v, %v after %d requests, want 200 after 2 requests", resp, err, atomic.LoadInt32(requests))
+			}
+
+			if elapsed < test.min || elapsed > test.max {
+				t.Errorf("send() waited %s for Retry-After %q, want between %s and %s", elapsed, test.retryAfter, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestSendCancelledWhileWaiting(t *testing.T) {
+	setupRetry(3, time.Nanosecond, time.Minute)
+	server, requests := statusServer("60", 503)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := send(ctx, resty.MethodGet, server.URL, nil)
+
+	if err != context.Canceled {
+		t.Errorf("send() error = %v, want %v", err, context.Canceled)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("send() returned %s after the cancellation", elapsed)
+	}
+
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("send() made %d requests, want 1", got)
+	}
+}
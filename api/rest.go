@@ -1,40 +1,64 @@
 package api
 
 import (
-	log "github.com/sirupsen/logrus"
-	"github.com/sn-edit/sn-edit/conf"
+	"context"
+	"github.com/go-resty/resty/v2"
 )
 
-func Get(url string) ([]byte, error) {
-	restClient := conf.GetClient()
+func Get(ctx context.Context, url string) ([]byte, error) {
+	resp, err := send(ctx, resty.MethodGet, url, nil)
 
-	resp, err := restClient.R().
-		Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkStatus(resp, url, 200)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body(), nil
+}
+
+func Put(ctx context.Context, url string, body interface{}) ([]byte, error) {
+	resp, err := send(ctx, resty.MethodPut, url, body)
 
 	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Error("There was a problem getting the entry from the instance! Please try again later!")
 		return nil, err
 	}
 
-	if resp.StatusCode() != 200 {
-		log.WithFields(log.Fields{"status_code": resp.StatusCode()}).Error("We received a HTTP Error Code from the Instance. Please check your config file and try again.")
+	err = checkStatus(resp, url, 200)
+
+	if err != nil {
 		return nil, err
 	}
 
 	return resp.Body(), nil
 }
 
-func Put(url string, body interface{}) ([]byte, error) {
-	restClient := conf.GetClient()
+func Post(ctx context.Context, url string, body interface{}) ([]byte, error) {
+	resp, err := send(ctx, resty.MethodPost, url, body)
+
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := restClient.R().
-		SetBody(body).
-		Put(url)
+	err = checkStatus(resp, url, 201)
 
 	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Error("There was a problem uploading the entry from the instance! Please try again later!")
 		return nil, err
 	}
 
 	return resp.Body(), nil
 }
+
+func Delete(ctx context.Context, url string) error {
+	resp, err := send(ctx, resty.MethodDelete, url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	return checkStatus(resp, url, 204, 200)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// the token could not be read, the requests are not retried
+var (
+	errTokenNotFound = errors.New("token_not_found")
+	errTokenCommand  = errors.New("token_command_failed")
+)
+
+// configuredToken is the api key or bearer token of the config file (app.core.rest.token.value),
+// an environment variable (app.core.rest.token.env) or the output of a command (app.core.rest.token.command),
+// the first one configured is used
+type configuredToken struct {
+	mutex   sync.Mutex
+	token   string
+	value   bool
+	env     string
+	command string
+}
+
+// newConfiguredToken reads the configured source of the token, the token is read on the first request
+func newConfiguredToken() *configuredToken {
+	config := conf.GetConfig()
+
+	return &configuredToken{
+		value:   config.IsSet("app.core.rest.token.value"),
+		env:     config.GetString("app.core.rest.token.env"),
+		command: config.GetString("app.core.rest.token.command"),
+	}
+}
+
+// Token returns the token, the command is only run again if the instance refused its last token
+func (t *configuredToken) Token(ctx context.Context) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.token) > 0 {
+		return t.token, nil
+	}
+
+	var err error
+
+	switch {
+	case t.value:
+		t.token = loadSecret("app.core.rest.token.value", "app.core.rest.token.masked")
+	case len(t.env) > 0:
+		t.token = os.Getenv(t.env)
+	case len(t.command) > 0:
+		t.token, err = runTokenCommand(ctx, t.command)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	t.token = strings.TrimSpace(t.token)
+
+	if len(t.token) == 0 {
+		log.WithFields(log.Fields{"error": errTokenNotFound, "env": t.env, "command": t.command}).Error("The token for the instance is empty! Please check your config file!")
+		return "", errTokenNotFound
+	}
+
+	return t.token, nil
+}
+
+// invalidate drops the refused token, a token of the config file or the environment is read again unchanged
+func (t *configuredToken) invalidate(token string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if token == t.token {
+		t.token = ""
+	}
+}
+
+// runTokenCommand runs the command in the shell and returns its output (like a token of a secret store or the identity provider)
+func runTokenCommand(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	output, err := cmd.Output()
+
+	if err != nil {
+		fields := log.Fields{"error": err, "command": command}
+
+		if exitError, ok := err.(*exec.ExitError); ok {
+			fields["stderr"] = strings.TrimSpace(string(exitError.Stderr))
+		}
+
+		log.WithFields(fields).Error("The token command failed!")
+		return "", errTokenCommand
+	}
+
+	return string(output), nil
+}
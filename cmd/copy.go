@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/icza/dyno"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/file"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var copyCmd = &cobra.Command{
+	Use:   "copy",
+	Short: "Copy an entry on servicenow into a new entry",
+	Long: `You can create a new entry from an existing entry on the instance (insert as new).
+The configured fields of the source entry are copied, use the set flag to override fields (for example --set name=NewName).
+The unique key of the table is not copied, set it or a field the instance derives it from (like the name of a script include).
+The copy is refused before it is created if it would get the directory of a downloaded entry.
+The new entry is created in the scope of the source entry, unless a scope is provided, and in the update set selected
+for that scope, unless an update set is provided. Afterwards the new entry is downloaded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := conf.GetConfig()
+
+		tableName, err := cmd.Flags().GetString("table")
+
+		if err != nil {
+			conf.Err("Parsing error table flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(tableName) == 0 {
+			conf.Err("Please provide a valid table flag!", log.Fields{"error": errors.New("invalid_table")}, true)
+		}
+
+		sysID, err := cmd.Flags().GetString("sys_id")
+
+		if err != nil {
+			conf.Err("Parsing error sys_id flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(sysID) != 32 {
+			conf.Err("Please provide a valid sys_id flag!", log.Fields{"error": errors.New("invalid_sys_id")}, true)
+		}
+
+		overrides, err := cmd.Flags().GetStringArray("set")
+
+		if err != nil {
+			conf.Err("Parsing error set flag!", log.Fields{"error": err}, true)
+		}
+
+		overrideValues := map[string]string{}
+
+		for _, override := range overrides {
+			parts := strings.SplitN(override, "=", 2)
+
+			if len(parts) != 2 || len(parts[0]) == 0 {
+				conf.Err("Please provide the set flag as field=value!", log.Fields{"error": errors.New("invalid_set_flag"), "set": override}, true)
+			}
+
+			overrideValues[parts[0]] = parts[1]
+		}
+
+		scopeName, err := cmd.Flags().GetString("scope")
+
+		if err != nil {
+			conf.Err("Parsing error scope flag!", log.Fields{"error": err}, true)
+		}
+
+		updateSet, err := cmd.Flags().GetString("update_set")
+
+		if err != nil {
+			conf.Err("Parsing error update_set flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(updateSet) > 0 && len(updateSet) != 32 {
+			log.Info("Get a list of sys_id's by calling the updateset --list command!")
+			conf.Err("Please provide a valid update_set flag!", log.Fields{"error": errors.New("invalid_sys_id")}, true)
+		}
+
+		// get table configuration from the config file
+		tablesConfig := config.Get("app.tables").([]interface{})
+
+		if !conf.ContainsField(conf.GetTableNames(tablesConfig), tableName) {
+			conf.Err("The table is not configured, please add it to the config file first!", log.Fields{"error": errors.New("table_not_configured"), "table": tableName}, true)
+		}
+
+		uniqueKey, err := conf.GetUniqueKeyForTable(tablesConfig, tableName)
+
+		if err != nil {
+			conf.Err("Invalid tables config!", log.Fields{"error": err}, true)
+		}
+
+		fields := conf.EnforceFields(tablesConfig, tableName, conf.GetTableFieldNames(tablesConfig, tableName))
+
+		// the overridden fields are requested as well, to find the field the unique key is derived from
+		sourceFields := append([]string{}, fields...)
+
+		for fieldName := range overrideValues {
+			if !conf.ContainsField(sourceFields, fieldName) {
+				sourceFields = append(sourceFields, fieldName)
+			}
+		}
+
+		source, err := requestEntry(cmd.Context(), tableName, sysID, sourceFields)
+
+		if err != nil {
+			conf.Err("There was an error while downloading the source entry!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+		}
+
+		if len(scopeName) == 0 {
+			scopeName, err = recordScopeName(cmd.Context(), source)
+
+			if err != nil {
+				conf.Err("Could not determine the scope of the source entry!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+			}
+		}
+
+		data := map[string]interface{}{}
+
+		for _, fieldName := range entryFileFields(tablesConfig, tableName) {
+			if fieldName == "sys_id" || fieldName == uniqueKey {
+				continue
+			}
+
+			value, err := dyno.GetString(source, fieldName)
+
+			if err != nil {
+				conf.Err("Invalid key!", log.Fields{"error": err, "field": fieldName}, true)
+			}
+
+			data[fieldName] = value
+		}
+
+		for fieldName, value := range overrideValues {
+			data[fieldName] = value
+		}
+
+		// a copy with the location of an existing entry would overwrite its files, it is refused before it is created
+		copyKey := copyUniqueKey(source, uniqueKey, overrideValues)
+
+		if err := checkEntryDirectory(db.Entry{TableName: tableName, ScopeName: scopeName, UniqueKey: copyKey}); err != nil {
+			conf.Err("The copy would get the directory of an existing entry! Please provide a new unique key with --set "+uniqueKey+"=...", log.Fields{"error": err, "table": tableName, "sys_id": sysID, "name": copyKey}, true)
+		}
+
+		result, err := createEntry(cmd.Context(), tablesConfig, tableName, scopeName, data, updateSet)
+
+		if err != nil {
+			conf.Err(instanceErrorMessage(err, "There was an error while creating the copy!"), log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+		}
+
+		copySysID, _ := dyno.GetString(result, "sys_id")
+		uniqueKeyName, _ := dyno.GetString(result, uniqueKey)
+		copyDirectory := file.GenerateDirectoryPath(tableName, scopeName, uniqueKeyName)
+
+		// the instance could derive the unique key differently than expected
+		if found, entry := db.QueryEntry(tableName, sysID); found && copyDirectory == file.GenerateDirectoryPath(tableName, entry.ScopeName, entry.UniqueKey) {
+			conf.Err("The copy has the name of the source entry and is not downloaded! Rename it and download it afterwards!", log.Fields{"error": errors.New("duplicate_unique_key"), "table": tableName, "sys_id": copySysID, "name": uniqueKeyName}, true)
+		}
+
+		err = saveEntry(cmd.Context(), tablesConfig, tableName, fields, result)
+
+		if err != nil {
+			conf.Err("Could not save the entry!", log.Fields{"error": err, "table": tableName, "sys_id": copySysID}, true)
+		}
+
+		log.WithFields(log.Fields{"table": tableName, "sys_id": copySysID, "source_sys_id": sysID, "scope": scopeName, "directory": copyDirectory}).Info("Entry successfully copied!")
+	},
+}
+
+// copyUniqueKey returns the unique key the copy is expected to get: the overridden unique key,
+// or the value of an overridden field the source derived its unique key from (like the name of a script include)
+func copyUniqueKey(source interface{}, uniqueKey string, overrideValues map[string]string) string {
+	if value, found := overrideValues[uniqueKey]; found {
+		return value
+	}
+
+	sourceKey, _ := dyno.GetString(source, uniqueKey)
+
+	for fieldName, value := range overrideValues {
+		if sourceValue, err := dyno.GetString(source, fieldName); err == nil && sourceValue == sourceKey {
+			return value
+		}
+	}
+
+	return sourceKey
+}
+
+// recordScopeName returns the name of the scope of a record (for example x_acme_app)
+func recordScopeName(ctx context.Context, record interface{}) (string, error) {
+	scopeSysID, err := dyno.GetString(record, "sys_scope.sys_id")
+
+	if err != nil {
+		conf.Err("Invalid scope for entry!", log.Fields{"error": err}, false)
+		return "", err
+	}
+
+	if found, _ := db.QueryScope(scopeSysID); !found {
+		_, err = db.RequestScopeDataFromInstance(ctx, scopeSysID)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	found, scopeName := db.GetScopeNameFromSysID(scopeSysID)
+
+	if !found {
+		return "", errors.New("scope_not_found")
+	}
+
+	return scopeName, nil
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/icza/dyno"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/api"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/file"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var createCmd = &cobra.Command{
+	Use:   "create <directory>",
+	Short: "Create a new entry on servicenow from the files of a local directory",
+	Long: `You can create a new entry (for example a script include) on the instance from a local directory.
+The directory should contain a file for every field you would like to set, named like the downloaded files
+(for example script.js and sys_name.txt). The file of the unique key of the table is required.
+The entry is created in the given scope and in the update set selected for the scope, unless an update set is provided.
+Afterwards the entry is downloaded and the directory is moved to the location the download command would use.
+The entry is not created if that location belongs to a downloaded entry.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := conf.GetConfig()
+
+		if len(args) != 1 {
+			conf.Err("Please provide the directory of the new entry!", log.Fields{"error": errors.New("invalid_directory")}, true)
+		}
+
+		directoryPath := args[0]
+
+		if info, err := os.Stat(directoryPath); err != nil || !info.IsDir() {
+			conf.Err("Please provide a valid directory!", log.Fields{"error": errors.New("invalid_directory"), "directory": directoryPath}, true)
+		}
+
+		tableName, err := cmd.Flags().GetString("table")
+
+		if err != nil {
+			conf.Err("Parsing error table flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(tableName) == 0 {
+			conf.Err("Please provide a valid table flag!", log.Fields{"error": errors.New("invalid_table")}, true)
+		}
+
+		scopeName, err := cmd.Flags().GetString("scope")
+
+		if err != nil {
+			conf.Err("Parsing error scope flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(scopeName) == 0 {
+			conf.Err("Please provide a valid scope flag!", log.Fields{"error": errors.New("invalid_scope")}, true)
+		}
+
+		updateSet, err := cmd.Flags().GetString("update_set")
+
+		if err != nil {
+			conf.Err("Parsing error update_set flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(updateSet) > 0 && len(updateSet) != 32 {
+			log.Info("Get a list of sys_id's by calling the updateset --list command!")
+			conf.Err("Please provide a valid update_set flag!", log.Fields{"error": errors.New("invalid_sys_id")}, true)
+		}
+
+		// get table configuration from the config file
+		tablesConfig := config.Get("app.tables").([]interface{})
+
+		if !conf.ContainsField(conf.GetTableNames(tablesConfig), tableName) {
+			conf.Err("The table is not configured, please add it to the config file first!", log.Fields{"error": errors.New("table_not_configured"), "table": tableName}, true)
+		}
+
+		data, err := readDirectoryFields(tablesConfig, tableName, directoryPath)
+
+		if err != nil {
+			conf.Err("Could not read the fields of the new entry!", log.Fields{"error": err, "directory": directoryPath}, true)
+		}
+
+		uniqueKey, err := conf.GetUniqueKeyForTable(tablesConfig, tableName)
+
+		if err != nil {
+			conf.Err("Invalid tables config!", log.Fields{"error": err}, true)
+		}
+
+		if value, found := data[uniqueKey]; !found || len(strings.TrimSpace(value.(string))) == 0 {
+			uniqueKeyFile := filepath.Base(fieldPath(tablesConfig, tableName, directoryPath, uniqueKey))
+			conf.Err(fmt.Sprintf("Please provide the unique key of the entry in the %s file!", uniqueKeyFile), log.Fields{"error": errors.New("unique_key_not_found"), "directory": directoryPath}, true)
+		}
+
+		// the download of the new entry would overwrite the files of a downloaded entry, it is refused before it is created
+		if err := checkEntryDirectory(db.Entry{TableName: tableName, ScopeName: scopeName, UniqueKey: data[uniqueKey].(string)}); err != nil {
+			conf.Err("The new entry would get the directory of an existing entry! Please change its unique key.", log.Fields{"error": err, "table": tableName, "scope": scopeName, "name": data[uniqueKey]}, true)
+		}
+
+		result, err := createEntry(cmd.Context(), tablesConfig, tableName, scopeName, data, updateSet)
+
+		if err != nil {
+			conf.Err(instanceErrorMessage(err, "There was an error while creating the entry!"), log.Fields{"error": err, "table": tableName, "scope": scopeName}, true)
+		}
+
+		sysID, _ := dyno.GetString(result, "sys_id")
+		uniqueKeyName, _ := dyno.GetString(result, uniqueKey)
+
+		// the files of the directory are the contents of the new entry, move them to their final location
+		err = moveEntryDirectory(directoryPath, file.GenerateDirectoryPath(tableName, scopeName, uniqueKeyName))
+
+		if err != nil {
+			conf.Err("Could not move the directory of the new entry!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+		}
+
+		err = saveEntry(cmd.Context(), tablesConfig, tableName, conf.EnforceFields(tablesConfig, tableName, conf.GetTableFieldNames(tablesConfig, tableName)), result)
+
+		if err != nil {
+			conf.Err("Could not save the entry!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+		}
+
+		log.WithFields(log.Fields{"table": tableName, "sys_id": sysID, "scope": scopeName, "directory": file.GenerateDirectoryPath(tableName, scopeName, uniqueKeyName)}).Info("Entry successfully created!")
+	},
+}
+
+// readDirectoryFields reads the files of the configured fields of the table from the directory,
+// fields without a file are not set, the sys_id is always given by the instance
+func readDirectoryFields(tablesConfig []interface{}, tableName string, directoryPath string) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+
+	for _, fieldName := range entryFileFields(tablesConfig, tableName) {
+		if fieldName == "sys_id" {
+			continue
+		}
+
+		filePath := fieldPath(tablesConfig, tableName, directoryPath, fieldName)
+
+		content, err := readField(tablesConfig, tableName, directoryPath, fieldName, "")
+
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			conf.Err("File read error! Please check permissions!", log.Fields{"error": err, "file": filePath}, false)
+			return nil, err
+		}
+
+		err = checkFieldFormat(tablesConfig, tableName, fieldName, content)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data[fieldName] = string(content)
+	}
+
+	if len(data) == 0 {
+		err := errors.New("fields_not_found")
+		conf.Err("The directory does not contain a file of a configured field!", log.Fields{"error": err, "directory": directoryPath}, false)
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// createEntry creates a new record with the given field values in the scope on the instance
+// and returns the record with the configured fields. Without an update set the current
+// update set of the scope is used.
+func createEntry(ctx context.Context, tablesConfig []interface{}, tableName string, scopeName string, data map[string]interface{}, updateSet string) (interface{}, error) {
+	config := conf.GetConfig()
+
+	found, _, scopeSysID := db.ScopeExists(scopeName)
+
+	if !found {
+		var err error
+		scopeSysID, err = db.RequestScopeDataByName(ctx, scopeName)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(scopeSysID) == 0 {
+			err = errors.New("scope_not_found")
+			conf.Err("The scope could not be found on the instance!", log.Fields{"error": err, "scope": scopeName}, false)
+			return nil, err
+		}
+	}
+
+	data["sys_scope"] = scopeSysID
+
+	if len(updateSet) == 0 {
+		var err error
+		updateSet, err = requireCurrentUpdateSet(scopeName)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// marshal into JSON
+	dataJSON, err := json.Marshal(data)
+
+	if err != nil {
+		conf.Err("JSON marshalling error!", log.Fields{"error": err}, false)
+		return nil, err
+	}
+
+	fields := conf.EnforceFields(tablesConfig, tableName, conf.GetTableFieldNames(tablesConfig, tableName))
+
+	createURL := fmt.Sprintf("%s/api/now/table/%s?sysparm_fields=%s&sysparm_scope=%s", config.GetString("app.core.rest.url"), tableName, strings.Join(requestFields(fields), ","), scopeName)
+
+	// if there is an update set passed
+	if len(updateSet) == 32 {
+		createURL = createURL + "&sysparm_transaction_update_set=" + updateSet
+	}
+
+	log.WithFields(log.Fields{"table": tableName, "scope": scopeName}).Info("Creating the entry on the instance...")
+
+	response, err := api.Post(ctx, createURL, dataJSON)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var responseResult map[string]interface{}
+	err = json.Unmarshal(response, &responseResult)
+
+	if err != nil {
+		conf.Err("There was an error while unmarshalling the response!", log.Fields{"error": err}, false)
+		return nil, err
+	}
+
+	result, err := dyno.Get(responseResult, "result")
+
+	if err != nil {
+		conf.Err("Invalid key!", log.Fields{"error": err}, false)
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/api"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/file"
+	"github.com/spf13/cobra"
+	"os"
+	"sort"
+	"strings"
+)
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete an entry on servicenow and remove its local files",
+	Long: `You can delete a downloaded entry on the instance. The deletion is recorded in the given update set,
+or in the update set selected for the scope of the entry. Afterwards the local directory of the entry is removed.
+The name of the entry is shown and you have to confirm the deletion, unless the yes flag is set.
+An entry with local changes which were not uploaded is not deleted, unless the force flag is set.
+The directory is kept if it does not belong to the entry alone (shared with another entry or the table).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		tableName, err := cmd.Flags().GetString("table")
+
+		if err != nil {
+			conf.Err("Parsing error table flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(tableName) == 0 {
+			conf.Err("Please provide a valid table flag!", log.Fields{"error": errors.New("invalid_table")}, true)
+		}
+
+		sysID, err := cmd.Flags().GetString("sys_id")
+
+		if err != nil {
+			conf.Err("Parsing error sys_id flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(sysID) != 32 {
+			conf.Err("Please provide a valid sys_id flag!", log.Fields{"error": errors.New("invalid_sys_id")}, true)
+		}
+
+		updateSet, err := cmd.Flags().GetString("update_set")
+
+		if err != nil {
+			conf.Err("Parsing error update_set flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(updateSet) > 0 && len(updateSet) != 32 {
+			log.Info("Get a list of sys_id's by calling the updateset --list command!")
+			conf.Err("Please provide a valid update_set flag!", log.Fields{"error": errors.New("invalid_sys_id")}, true)
+		}
+
+		yes, err := cmd.Flags().GetBool("yes")
+
+		if err != nil {
+			conf.Err("Parsing error yes flag!", log.Fields{"error": err}, true)
+		}
+
+		force, err := cmd.Flags().GetBool("force")
+
+		if err != nil {
+			conf.Err("Parsing error force flag!", log.Fields{"error": err}, true)
+		}
+
+		found, entry := db.QueryEntry(tableName, sysID)
+
+		if !found {
+			conf.Err("The entry could not be found! Please download it first!", log.Fields{"error": errors.New("entry_not_found"), "table": tableName, "sys_id": sysID}, true)
+		}
+
+		if !force {
+			changed, err := localChanges(conf.GetConfig().Get("app.tables").([]interface{}), entry)
+
+			if err != nil {
+				conf.Err("Could not check the local files of the entry!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+			}
+
+			if len(changed) > 0 {
+				conf.Err("The entry has local changes which were not uploaded! Use the force flag to delete it anyway.", log.Fields{"error": errors.New("local_changes"), "table": tableName, "sys_id": sysID, "fields": strings.Join(changed, ",")}, true)
+			}
+		}
+
+		if !yes && !confirm(fmt.Sprintf("Delete %s %q (%s) in the %s scope from the instance?", tableName, entry.UniqueKey, sysID, entry.ScopeName)) {
+			log.WithFields(log.Fields{"table": tableName, "sys_id": sysID, "name": entry.UniqueKey}).Info("Nothing was deleted!")
+			return
+		}
+
+		err = deleteEntry(cmd.Context(), entry, updateSet)
+
+		if err != nil {
+			conf.Err(instanceErrorMessage(err, "There was an error while deleting the entry!"), log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+		}
+
+		log.WithFields(log.Fields{"table": tableName, "sys_id": sysID, "name": entry.UniqueKey}).Info("Entry successfully deleted!")
+	},
+}
+
+// confirm asks the question on the terminal and reports if it was answered with yes
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	if err != nil && len(answer) == 0 {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
+// deleteEntry deletes the entry on the instance, recording it in the update set
+// (the current one of the scope if not given), and removes the local files and the database state
+func deleteEntry(ctx context.Context, entry db.Entry, updateSet string) error {
+	config := conf.GetConfig()
+
+	if len(updateSet) == 0 {
+		var err error
+		updateSet, err = requireCurrentUpdateSet(entry.ScopeName)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	deleteURL := fmt.Sprintf("%s/api/now/table/%s/%s?sysparm_scope=%s", config.GetString("app.core.rest.url"), entry.TableName, entry.SysID, entry.ScopeName)
+
+	// if there is an update set passed
+	if len(updateSet) == 32 {
+		deleteURL = deleteURL + "&sysparm_transaction_update_set=" + updateSet
+	}
+
+	log.WithFields(log.Fields{"sys_id": entry.SysID, "table": entry.TableName, "scope": entry.ScopeName}).Info("Deleting the entry on the instance...")
+
+	err := api.Delete(ctx, deleteURL)
+
+	if err != nil {
+		return err
+	}
+
+	return removeEntry(entry)
+}
+
+// removeEntry removes the local directory and the database state of the entry,
+// a directory which does not belong to the entry alone is kept
+func removeEntry(entry db.Entry) error {
+	directoryPath := file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, entry.UniqueKey)
+
+	err := checkEntryDirectory(entry)
+
+	switch err {
+	case nil:
+		err = os.RemoveAll(directoryPath)
+
+		if err != nil {
+			conf.Err("Could not remove the directory of the entry!", log.Fields{"error": err, "directory": directoryPath}, false)
+			return err
+		}
+	case errInvalidEntryDirectory, errSharedEntryDirectory:
+		log.WithFields(log.Fields{"warn": err, "directory": directoryPath, "sys_id": entry.SysID}).Warn("The directory does not belong to the entry alone and is not removed!")
+	default:
+		conf.Err("Could not check the directory of the entry!", log.Fields{"error": err, "directory": directoryPath}, false)
+		return err
+	}
+
+	return db.DeleteEntry(entry.ID)
+}
+
+// localChanges returns the tracked fields of the entry whose files were changed since the last download
+func localChanges(tablesConfig []interface{}, entry db.Entry) ([]string, error) {
+	entryFields, err := db.QueryEntryFields(entry.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fieldsSlice := make([]string, 0, len(entryFields))
+
+	for fieldName := range entryFields {
+		fieldsSlice = append(fieldsSlice, fieldName)
+	}
+
+	sort.Strings(fieldsSlice)
+
+	return changedFields(tablesConfig, entry, fieldsSlice)
+}
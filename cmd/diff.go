@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/icza/dyno"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/diff"
+	"github.com/sn-edit/sn-edit/file"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+// fieldDiff holds the changes of one field between the instance and the local file
+type fieldDiff struct {
+	Field   string      `json:"field"`
+	Path    string      `json:"path"`
+	Changed bool        `json:"changed"`
+	Hunks   []diff.Hunk `json:"hunks"`
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the differences between the local files and the instance",
+	Long: `The command requests the current values of the fields from the instance and prints
+a unified diff against the local files of the entry. This shows what an upload would overwrite.
+Providing fields is optional, if you do not provide any, every configured field of the entry is compared.
+With the json flag the changes are returned as hunks.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := conf.GetConfig()
+
+		tableName, err := cmd.Flags().GetString("table")
+
+		if err != nil {
+			conf.Err("Parsing error table flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(tableName) == 0 {
+			conf.Err("Please provide a valid table flag!", log.Fields{"error": errors.New("invalid_table")}, true)
+		}
+
+		sysID, err := cmd.Flags().GetString("sys_id")
+
+		if err != nil {
+			conf.Err("Parsing error sys_id flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(sysID) != 32 {
+			conf.Err("Please provide a valid sys_id flag!", log.Fields{"error": errors.New("invalid_sys_id")}, true)
+		}
+
+		fields, err := cmd.Flags().GetString("fields")
+
+		if err != nil {
+			conf.Err("Parsing error fields flag!", log.Fields{"error": err}, true)
+		}
+
+		// get table configuration from the config file
+		tablesConfig := config.Get("app.tables").([]interface{})
+
+		fieldsSlice := entryFileFields(tablesConfig, tableName)
+
+		if len(fields) > 0 {
+			fieldsSlice = strings.Split(fields, ",")
+		}
+
+		found, entry := db.QueryEntry(tableName, sysID)
+
+		if !found {
+			conf.Err("The entry could not be found! Please download it first!", log.Fields{"error": errors.New("entry_not_found"), "table": tableName, "sys_id": sysID}, true)
+		}
+
+		entryFields, err := db.QueryEntryFields(entry.ID)
+
+		if err != nil {
+			conf.Err("Could not read the fields of the entry from the database!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+		}
+
+		result, err := requestEntry(cmd.Context(), tableName, sysID, fieldsSlice)
+
+		if err != nil {
+			conf.Err("There was an error while requesting the entry!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+		}
+
+		rootDirectory := config.GetString("app.core.root_directory")
+		diffs := []fieldDiff{}
+		output := strings.Builder{}
+
+		for _, fieldName := range fieldsSlice {
+			remoteContent, err := dyno.GetString(result, fieldName)
+
+			if err != nil {
+				conf.Err("Invalid key!", log.Fields{"error": err, "field": fieldName}, true)
+			}
+
+			directoryPath := file.GenerateDirectoryPath(tableName, entry.ScopeName, entry.UniqueKey)
+			filePath := fieldPath(tablesConfig, tableName, directoryPath, fieldName)
+
+			// a missing file is compared as empty
+			localContent, err := readField(tablesConfig, tableName, directoryPath, fieldName, entryFields[fieldName].Base)
+
+			if err != nil {
+				if !os.IsNotExist(err) {
+					conf.Err("File read error! Please check permissions!", log.Fields{"error": err, "file": filePath}, true)
+				}
+
+				log.WithFields(log.Fields{"file": filePath}).Warn("The file does not exist locally!")
+			}
+
+			// formatted fields are compared pretty-printed, like in the files
+			remoteLines := diff.SplitLines(string(fieldFileContents(tablesConfig, tableName, fieldName, []byte(remoteContent))))
+			localLines := diff.SplitLines(string(fieldFileContents(tablesConfig, tableName, fieldName, localContent)))
+			hunks := diff.Hunks(remoteLines, localLines, 3)
+			path := relativePath(rootDirectory, filePath)
+
+			// the fields of the record file share one file
+			if conf.IsRecordField(tablesConfig, tableName, fieldName) {
+				path = path + ":" + fieldName
+			}
+
+			diffs = append(diffs, fieldDiff{Field: fieldName, Path: path, Changed: len(hunks) > 0, Hunks: hunks})
+			output.WriteString(diff.Unified("remote/"+path, "local/"+path, remoteLines, localLines, hunks))
+		}
+
+		if outputJSON, _ := cmd.Flags().GetBool("json"); outputJSON {
+			log.WithFields(log.Fields{"table": tableName, "sys_id": sysID, "fields": diffs}).Info("Differences to the instance!")
+			return
+		}
+
+		if output.Len() == 0 {
+			fmt.Println("No differences found!")
+			return
+		}
+
+		fmt.Print(output.String())
+	},
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/icza/dyno"
@@ -12,6 +13,8 @@ import (
 	"github.com/sn-edit/sn-edit/file"
 	"github.com/spf13/cobra"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -53,100 +56,275 @@ Otherwise sn-edit will not be able to determine the location or download the dat
 		// enforce sys_id and scope if not present already
 		fields = conf.EnforceFields(tablesConfig, tableName, fields)
 
-		// setup the download url
-		downloadURL := config.GetString("app.core.rest.url") + "/api/now/table/" + tableName + "/" + sysID + "?sysparm_fields=" + strings.Join(fields, ",")
-
-		log.WithFields(log.Fields{"api_url": downloadURL}).Debug()
 		log.WithFields(log.Fields{"sys_id": sysID, "table": tableName, "fields": fields}).Info("Downloading the data from the instance")
 
-		response, err := api.Get(downloadURL)
+		result, err := requestEntry(cmd.Context(), tableName, sysID, requestFields(fields))
 
 		if err != nil {
-			return
+			conf.Err("There was an error while downloading the entry!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
 		}
 
-		// unmarshal response
-		var responseResult map[string]interface{}
-		err = json.Unmarshal(response, &responseResult)
+		err = saveEntry(cmd.Context(), tablesConfig, tableName, fields, result)
 
 		if err != nil {
-			conf.Err("There was an error while unmarshalling the response!", log.Fields{"error": err}, true)
+			conf.Err("Could not save the entry!", log.Fields{"error": err, "table_name": tableName, "sys_id": sysID}, true)
 		}
 
-		result, err := dyno.Get(responseResult, "result")
+		log.WithFields(log.Fields{"table_name": tableName, "sys_id": sysID}).Info("Entry successfully downloaded!")
+	},
+}
 
-		if err != nil {
-			conf.Err(err, log.Fields{"error": err}, true)
+// saveEntry writes one record received from the table API into the database
+// and its configured fields into the directory structure
+func saveEntry(ctx context.Context, tablesConfig []interface{}, tableName string, fields []string, result interface{}) error {
+	uniqueKey, err := conf.GetUniqueKeyForTable(tablesConfig, tableName)
+
+	if err != nil {
+		conf.Err("Invalid tables config!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	uniqueKeyName, err := dyno.GetString(result, uniqueKey)
+
+	if err != nil {
+		conf.Err("Invalid unique key!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	log.WithFields(log.Fields{"name": uniqueKeyName}).Debug("Entry identified!")
+
+	sysID, err := dyno.GetString(result, "sys_id")
+
+	if err != nil {
+		conf.Err("Invalid sys_id for entry!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	fieldScopeSysID, err := dyno.GetString(result, "sys_scope.sys_id")
+
+	if err != nil {
+		conf.Err("Invalid scope for entry!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	// the location of the last download, in case the entry was renamed or moved to another scope
+	downloaded, previous := db.QueryEntry(tableName, sysID)
+
+	// write entry to the db
+	err = db.WriteEntry(ctx, tableName, uniqueKeyName, sysID, fieldScopeSysID)
+
+	if err != nil {
+		conf.Err("Could not write entry to the database!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	found, fieldScopeName := db.GetScopeNameFromSysID(fieldScopeSysID)
+
+	// scope names in lowercase in folder structure
+	fieldScopeName = strings.ToLower(fieldScopeName)
+
+	if !found {
+		err = errors.New("scope_not_found")
+		conf.Err("Scope not found in the database!", log.Fields{"error": err, "name": fieldScopeName, "sys_id": fieldScopeSysID}, false)
+		return err
+	}
+
+	// create directory for sys_name
+	directoryPath := file.GenerateDirectoryPath(tableName, fieldScopeName, uniqueKeyName)
+
+	if previousPath := file.GenerateDirectoryPath(tableName, previous.ScopeName, previous.UniqueKey); downloaded && filepath.Clean(previousPath) != filepath.Clean(directoryPath) {
+		// only a directory of the entry alone is moved, otherwise the entry is downloaded into the new directory
+		if err := checkEntryDirectory(previous); err != nil {
+			log.WithFields(log.Fields{"error": err, "from": previousPath, "to": directoryPath}).Warn("The previous directory does not belong to the entry alone and is not moved, the entry is downloaded into the new directory!")
+		} else {
+			err = moveEntryDirectory(previousPath, directoryPath)
+
+			if err != nil {
+				return err
+			}
 		}
+	}
 
-		uniqueKey, err := conf.GetUniqueKeyForTable(tablesConfig, tableName)
+	_, err = directory.CreateDirectoryStructure(directoryPath)
 
-		if err != nil {
-			conf.Err("Invalid tables config!", log.Fields{"error": err}, true)
+	if err != nil {
+		conf.Err("Error while creating directory structure!", log.Fields{"error": err, "directory": directoryPath}, false)
+		return err
+	}
+
+	// go through all the fields that are defined in the config
+	for _, fieldName := range fields {
+		// we do not need to download sys_scope
+		if strings.Contains(fieldName, "scope") {
+			continue
 		}
 
-		uniqueKeyName, err := dyno.GetString(result, uniqueKey)
+		fieldContent, err := dyno.GetString(result, fieldName)
 
 		if err != nil {
-			conf.Err("Invalid unique key!", log.Fields{"error": err}, true)
+			conf.Err("Invalid key!", log.Fields{"error": err}, false)
+			return err
 		}
 
-		log.WithFields(log.Fields{"name": uniqueKeyName}).Debug("Entry identified!")
+		contents := []byte(fieldContent)
 
-		fieldScopeSysID, err := dyno.GetString(result, "sys_scope.sys_id")
+		err = writeField(tablesConfig, tableName, directoryPath, fieldName, contents)
 
 		if err != nil {
-			// if no scope found, fallback to global
-			fieldScopeSysID = "global"
-			conf.Err("Invalid scope for entry!", log.Fields{"error": err}, true)
+			conf.Err("File write error! Please check permissions!", log.Fields{"error": err}, false)
+			return err
 		}
 
-		// write entry to the db
-		err = db.WriteEntry(tableName, uniqueKeyName, sysID, fieldScopeSysID)
+		// remember what was downloaded to detect the changes later
+		err = db.WriteEntryField(tableName, sysID, fieldName, file.Hash(contents), fieldContent)
 
 		if err != nil {
-			conf.Err("Could not write entry to the database!", log.Fields{"error": err}, true)
+			conf.Err("Could not write the field to the database!", log.Fields{"error": err, "field": fieldName}, false)
+			return err
 		}
+	}
+
+	return writeEntryRemote(tableName, sysID, result)
+}
+
+// moveEntryDirectory moves the directory of an entry to its new location (for example after a rename),
+// together with every other file the user placed there. An existing target is not overwritten.
+func moveEntryDirectory(previousPath string, directoryPath string) error {
+	if absolutePrevious, err := filepath.Abs(previousPath); err == nil {
+		previousPath = absolutePrevious
+	}
+
+	if absolutePath, err := filepath.Abs(directoryPath); err == nil {
+		directoryPath = absolutePath
+	}
+
+	if previousPath == directoryPath {
+		return nil
+	}
+
+	if _, err := os.Stat(previousPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	if _, err := os.Stat(directoryPath); err == nil {
+		log.WithFields(log.Fields{"from": previousPath, "to": directoryPath}).Warn("The directory of the entry can not be moved, the new directory exists already! Please remove the old directory by hand!")
+		return nil
+	}
 
-		found, fieldScopeName := db.GetScopeNameFromSysID(fieldScopeSysID)
+	_, err := directory.CreateDirectoryStructure(filepath.Dir(directoryPath))
 
-		// scope names in lowercase in folder structure
-		fieldScopeName = strings.ToLower(fieldScopeName)
+	if err != nil {
+		conf.Err("Error while creating directory structure!", log.Fields{"error": err, "directory": filepath.Dir(directoryPath)}, false)
+		return err
+	}
 
-		if !found {
-			conf.Err("Scope not found in the database!", log.Fields{"error": err, "name": fieldScopeName, "sys_id": fieldScopeSysID}, true)
+	err = os.Rename(previousPath, directoryPath)
+
+	if err != nil {
+		conf.Err("Error while moving the directory of the entry!", log.Fields{"error": err, "from": previousPath, "to": directoryPath}, false)
+		return err
+	}
+
+	log.WithFields(log.Fields{"from": previousPath, "to": directoryPath}).Info("The directory of the entry was moved!")
+
+	return nil
+}
+
+// requestEntry requests the fields of one record from the instance
+func requestEntry(ctx context.Context, tableName string, sysID string, fields []string) (interface{}, error) {
+	config := conf.GetConfig()
+
+	// setup the download url
+	downloadURL := config.GetString("app.core.rest.url") + "/api/now/table/" + tableName + "/" + sysID + "?sysparm_fields=" + strings.Join(fields, ",")
+
+	log.WithFields(log.Fields{"api_url": downloadURL}).Debug()
+
+	response, err := api.Get(ctx, downloadURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response == nil {
+		return nil, errors.New("empty_response")
+	}
+
+	// unmarshal response
+	var responseResult map[string]interface{}
+	err = json.Unmarshal(response, &responseResult)
+
+	if err != nil {
+		conf.Err("There was an error while unmarshalling the response!", log.Fields{"error": err}, false)
+		return nil, err
+	}
+
+	result, err := dyno.Get(responseResult, "result")
+
+	if err != nil {
+		conf.Err("Invalid key!", log.Fields{"error": err}, false)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// entryFileFields returns the fields of the table which are written to files
+func entryFileFields(tablesConfig []interface{}, tableName string) []string {
+	var result []string
+
+	for _, fieldName := range conf.EnforceFields(tablesConfig, tableName, conf.GetTableFieldNames(tablesConfig, tableName)) {
+		// we do not need to download sys_scope
+		if !strings.Contains(fieldName, "scope") {
+			result = append(result, fieldName)
 		}
+	}
+
+	return result
+}
 
-		// create directory for sys_name
-		directoryPath := config.GetString("app.core.root_directory") + string(os.PathSeparator) + fieldScopeName + string(os.PathSeparator) + tableName + string(os.PathSeparator) + file.FilterSpecialChars(uniqueKeyName)
-		_, err = directory.CreateDirectoryStructure(directoryPath)
+// requestFields adds the fields needed to track the changes of the entries on the instance,
+// these are requested together with the fields of the entry, but not written to files
+func requestFields(fields []string) []string {
+	result := append([]string{}, fields...)
 
-		if err != nil {
-			conf.Err("Error while creating directory structure!", log.Fields{"error": err, "directory": directoryPath}, true)
+	for _, field := range []string{"sys_updated_on", "sys_mod_count"} {
+		if !conf.ContainsField(result, field) {
+			result = append(result, field)
 		}
+	}
 
-		// go through all the fields that are defined in the config
-		for _, fieldName := range fields {
-			// we do not need to download sys_scope
-			if strings.Contains(fieldName, "scope") {
-				continue
-			}
+	return result
+}
 
-			fieldContent, err := dyno.GetString(result, fieldName)
+// writeEntryRemote stores the update counters of the record received from the instance
+func writeEntryRemote(tableName string, sysID string, result interface{}) error {
+	sysUpdatedOn, err := dyno.GetString(result, "sys_updated_on")
 
-			if err != nil {
-				conf.Err("Invalid key!", log.Fields{"error": err}, true)
-			}
+	if err != nil {
+		conf.Err("Invalid key!", log.Fields{"error": err}, false)
+		return err
+	}
 
-			fieldExtension := conf.GetFieldExtension(tablesConfig, tableName, fieldName)
+	sysModCount, err := dyno.GetString(result, "sys_mod_count")
 
-			err = file.WriteFile(tableName, fieldScopeName, uniqueKeyName, fieldName, fieldExtension, []byte(fieldContent))
+	if err != nil {
+		conf.Err("Invalid key!", log.Fields{"error": err}, false)
+		return err
+	}
 
-			if err != nil {
-				conf.Err("File write error! Please check permissions!", log.Fields{"error": err}, true)
-			}
-		}
+	modCount, err := strconv.ParseInt(sysModCount, 10, 64)
 
-		log.WithFields(log.Fields{"table_name": tableName, "sys_id": sysID}).Info("Entry successfully downloaded!")
-	},
+	if err != nil {
+		conf.Err("Invalid modification count!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	err = db.WriteEntryRemote(tableName, sysID, sysUpdatedOn, modCount)
+
+	if err != nil {
+		conf.Err("Could not write the entry to the database!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	return nil
 }
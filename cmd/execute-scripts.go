@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/api"
 	"github.com/sn-edit/sn-edit/conf"
 	"github.com/sn-edit/sn-edit/db"
 	"github.com/sn-edit/sn-edit/file"
@@ -14,6 +16,7 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"regexp"
+	"strings"
 )
 
 var executeScriptsCmd = &cobra.Command{
@@ -42,7 +45,7 @@ that has access to the Background Scripts functionality. Otherwise the feature m
 			conf.Err("Parsing error scope flag!", log.Fields{"error": err}, true)
 		}
 
-		scopeSysID, err := db.RequestScopeDataFromInstance(scopeName)
+		scopeSysID, err := db.RequestScopeDataByName(cmd.Context(), scopeName)
 
 		if err != nil {
 			conf.Err("Error while requesting scope data!", log.Fields{"error": err}, true)
@@ -62,7 +65,12 @@ that has access to the Background Scripts functionality. Otherwise the feature m
 			conf.Err("Error initializing cookie jar!", log.Fields{"error": err}, true)
 		}
 
-		client := &http.Client{Jar: cookieJar}
+		client := &http.Client{Jar: cookieJar, Timeout: api.RequestTimeout()}
+
+		// the scripts page does not accept the tokens of the rest api, the user logs in like in the browser
+		if !config.IsSet("app.core.rest.user") || !config.IsSet("app.core.rest.password") || !config.IsSet("app.core.rest.xor_key") {
+			conf.Err("Running scripts requires the user and password in the config file!", log.Fields{"error": errors.New("missing_credentials")}, true)
+		}
 
 		username := config.GetString("app.core.rest.user")
 		passwordCredential := config.GetString("app.core.rest.password")
@@ -81,7 +89,7 @@ that has access to the Background Scripts functionality. Otherwise the feature m
 		}
 
 		// get the CK key for login
-		resp1, err := client.Get(loginUrl.String())
+		resp1, err := getPage(cmd.Context(), client, loginUrl.String())
 
 		if err != nil {
 			conf.Err("There was an error while making the request!", log.Fields{"error": err}, true)
@@ -109,7 +117,7 @@ that has access to the Background Scripts functionality. Otherwise the feature m
 		form.Add("sysparm_ck", ckToken)
 
 		// login to the instance
-		resp2, err := client.PostForm(loginUrl.String(), form)
+		resp2, err := postForm(cmd.Context(), client, loginUrl.String(), form)
 
 		if err != nil {
 			conf.Err("There was an error with the login process!", log.Fields{"error": err}, true)
@@ -125,7 +133,7 @@ that has access to the Background Scripts functionality. Otherwise the feature m
 		}
 
 		// get the CK key
-		resp3, err := client.Get(scriptsEndpoint.String())
+		resp3, err := getPage(cmd.Context(), client, scriptsEndpoint.String())
 
 		if err != nil {
 			conf.Err("There was an error while making the request!", log.Fields{"error": err}, true)
@@ -159,7 +167,7 @@ that has access to the Background Scripts functionality. Otherwise the feature m
 		form.Add("runscript", "Run script")
 		form.Add("sysparm_ck", ckToken)
 
-		resp4, err := client.PostForm(scriptsEndpoint.String(), form)
+		resp4, err := postForm(cmd.Context(), client, scriptsEndpoint.String(), form)
 
 		if err != nil {
 			conf.Err("There was an error while executing the script!", log.Fields{"error": err}, true)
@@ -176,3 +184,27 @@ that has access to the Background Scripts functionality. Otherwise the feature m
 		}
 	},
 }
+
+// getPage requests the page, the request is cancelled with the context of the command
+func getPage(ctx context.Context, client *http.Client, pageURL string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(request)
+}
+
+// postForm submits the form to the page, the request is cancelled with the context of the command
+func postForm(ctx context.Context, client *http.Client, pageURL string, form url.Values) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, pageURL, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return client.Do(request)
+}
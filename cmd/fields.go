@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/file"
+	"github.com/sn-edit/sn-edit/format"
+	"path/filepath"
+	"strconv"
+)
+
+// fieldPath returns the file a field of the entry in the directory is stored in
+func fieldPath(tablesConfig []interface{}, tableName string, directoryPath string, fieldName string) string {
+	if conf.IsRecordField(tablesConfig, tableName, fieldName) {
+		return file.RecordPath(directoryPath)
+	}
+
+	return filepath.Join(directoryPath, fieldName+"."+conf.GetFieldExtension(tablesConfig, tableName, fieldName))
+}
+
+// entryFieldPath returns the file a field of a downloaded entry is stored in
+func entryFieldPath(tablesConfig []interface{}, tableName string, scopeName string, uniqueKeyName string, fieldName string) string {
+	return fieldPath(tablesConfig, tableName, file.GenerateDirectoryPath(tableName, scopeName, uniqueKeyName), fieldName)
+}
+
+// readField returns the local contents of a field. The value of a field in the record file
+// is returned as the instance stores it, so it can be compared with the downloaded value.
+// The line endings of the downloaded value (the base) are restored and a pretty-printed field
+// is compacted again if the base was compact.
+func readField(tablesConfig []interface{}, tableName string, directoryPath string, fieldName string, base string) ([]byte, error) {
+	if !conf.IsRecordField(tablesConfig, tableName, fieldName) {
+		content, err := file.RestoreFile(fieldPath(tablesConfig, tableName, directoryPath, fieldName), []byte(base))
+
+		if err != nil {
+			return nil, err
+		}
+
+		fieldFormat := conf.GetFieldFormat(tablesConfig, tableName, fieldName)
+
+		// new entries are compacted, invalid content is kept to be refused on upload
+		if len(fieldFormat) > 0 && (len(base) == 0 || format.IsCompact(fieldFormat, []byte(base))) {
+			if compacted, err := format.Compact(fieldFormat, content); err == nil {
+				return compacted, nil
+			}
+		}
+
+		return content, nil
+	}
+
+	value, err := file.ReadRecordField(directoryPath, fieldName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := encodeRecordValue(conf.GetFieldType(tablesConfig, tableName, fieldName), value)
+
+	if err != nil {
+		conf.Err(fmt.Sprintf("The value of the %s field in the record file is invalid!", fieldName), log.Fields{"error": err, "file": file.RecordPath(directoryPath), "type": conf.GetFieldType(tablesConfig, tableName, fieldName)}, false)
+		return nil, err
+	}
+
+	return []byte(content), nil
+}
+
+// writeField writes the contents of a field to its file, the file package applies the files policy. Compact values
+// of fields with a format are pretty-printed and the fields of the record file are stored with their type.
+func writeField(tablesConfig []interface{}, tableName string, directoryPath string, fieldName string, contents []byte) error {
+	if !conf.IsRecordField(tablesConfig, tableName, fieldName) {
+		return file.WriteFile(fieldPath(tablesConfig, tableName, directoryPath, fieldName), fieldFileContents(tablesConfig, tableName, fieldName, contents))
+	}
+
+	return file.WriteRecordField(directoryPath, fieldName, decodeRecordValue(conf.GetFieldType(tablesConfig, tableName, fieldName), string(contents)))
+}
+
+// fieldFileContents returns the contents of the file of a field for the value of the instance
+func fieldFileContents(tablesConfig []interface{}, tableName string, fieldName string, value []byte) []byte {
+	if fieldFormat := conf.GetFieldFormat(tablesConfig, tableName, fieldName); len(fieldFormat) > 0 {
+		return format.Pretty(fieldFormat, value)
+	}
+
+	return value
+}
+
+// checkFieldFormat refuses the content of a field which is not valid in the format of the field
+func checkFieldFormat(tablesConfig []interface{}, tableName string, fieldName string, content []byte) error {
+	fieldFormat := conf.GetFieldFormat(tablesConfig, tableName, fieldName)
+
+	if len(fieldFormat) == 0 || conf.IsRecordField(tablesConfig, tableName, fieldName) {
+		return nil
+	}
+
+	err := format.Validate(fieldFormat, content)
+
+	if err != nil {
+		conf.Err(fmt.Sprintf("The %s field is not valid %s!", fieldName, fieldFormat), log.Fields{"error": err, "field": fieldName, "format": fieldFormat}, false)
+		return err
+	}
+
+	return nil
+}
+
+// decodeRecordValue converts the value of the instance into the type of the field, values which
+// would not be written back the same way (like an empty integer) are kept as a string
+func decodeRecordValue(fieldType string, value string) interface{} {
+	switch fieldType {
+	case conf.FieldTypeBoolean:
+		if value == "true" || value == "false" {
+			return value == "true"
+		}
+	case conf.FieldTypeInteger:
+		if number, err := strconv.ParseInt(value, 10, 64); err == nil && strconv.FormatInt(number, 10) == value {
+			return number
+		}
+	}
+
+	return value
+}
+
+// encodeRecordValue converts the value of the record file into the representation of the instance,
+// a string is sent as written (decodeRecordValue keeps the values it can not convert as strings)
+func encodeRecordValue(fieldType string, value interface{}) (string, error) {
+	switch typed := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return typed, nil
+	case bool:
+		if fieldType == conf.FieldTypeInteger {
+			return "", errors.New("invalid_field_type")
+		}
+
+		return strconv.FormatBool(typed), nil
+	case int:
+		if fieldType == conf.FieldTypeBoolean {
+			return "", errors.New("invalid_field_type")
+		}
+
+		return strconv.Itoa(typed), nil
+	case int64:
+		if fieldType == conf.FieldTypeBoolean {
+			return "", errors.New("invalid_field_type")
+		}
+
+		return strconv.FormatInt(typed, 10), nil
+	case float64:
+		if fieldType != conf.FieldTypeString {
+			return "", errors.New("invalid_field_type")
+		}
+
+		return strconv.FormatFloat(typed, 'f', -1, 64), nil
+	}
+
+	return "", errors.New("invalid_field_type")
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/file"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRecordValueRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		fieldType string
+		value     string
+		decoded   interface{}
+	}{
+		{"string", conf.FieldTypeString, "hello", "hello"},
+		{"empty string", conf.FieldTypeString, "", ""},
+		{"string looking like a number", conf.FieldTypeString, "100", "100"},
+		{"true", conf.FieldTypeBoolean, "true", true},
+		{"false", conf.FieldTypeBoolean, "false", false},
+		{"empty boolean", conf.FieldTypeBoolean, "", ""},
+		{"capitalised boolean", conf.FieldTypeBoolean, "True", "True"},
+		{"integer", conf.FieldTypeInteger, "100", int64(100)},
+		{"negative integer", conf.FieldTypeInteger, "-5", int64(-5)},
+		{"empty integer", conf.FieldTypeInteger, "", ""},
+		{"integer with leading zero", conf.FieldTypeInteger, "0100", "0100"},
+		{"integer with plus sign", conf.FieldTypeInteger, "+1", "+1"},
+		{"decimal in an integer field", conf.FieldTypeInteger, "1.5", "1.5"},
+	}
+
+	directoryPath, err := ioutil.TempDir("", "sn-edit-record")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directoryPath)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded := decodeRecordValue(test.fieldType, test.value)
+
+			if !reflect.DeepEqual(decoded, test.decoded) {
+				t.Errorf("decodeRecordValue(%q, %q) = %#v, want %#v", test.fieldType, test.value, decoded, test.decoded)
+			}
+
+			encoded, err := encodeRecordValue(test.fieldType, decoded)
+
+			if err != nil || encoded != test.value {
+				t.Errorf("encodeRecordValue(%q, %#v) = %q, %v, want %q", test.fieldType, decoded, encoded, err, test.value)
+			}
+
+			// the value has to survive the record file as well
+			if err := file.WriteRecordField(directoryPath, "field", decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			read, err := file.ReadRecordField(directoryPath, "field")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encoded, err = encodeRecordValue(test.fieldType, read)
+
+			if err != nil || encoded != test.value {
+				t.Errorf("the record file returned %#v, encoded to %q, %v, want %q", read, encoded, err, test.value)
+			}
+		})
+	}
+}
+
+func TestEncodeRecordValueInvalidType(t *testing.T) {
+	tests := []struct {
+		name      string
+		fieldType string
+		value     interface{}
+	}{
+		{"boolean in an integer field", conf.FieldTypeInteger, true},
+		{"integer in a boolean field", conf.FieldTypeBoolean, 1},
+		{"decimal in an integer field", conf.FieldTypeInteger, 1.5},
+		{"list", conf.FieldTypeString, []interface{}{"a"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if encoded, err := encodeRecordValue(test.fieldType, test.value); err == nil {
+				t.Errorf("encodeRecordValue(%q, %#v) = %q, want an error", test.fieldType, test.value, encoded)
+			}
+		})
+	}
+}
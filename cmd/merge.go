@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/icza/dyno"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/diff"
+	"github.com/sn-edit/sn-edit/file"
+	"github.com/sn-edit/sn-edit/format"
+	"github.com/spf13/cobra"
+	"sort"
+	"strings"
+)
+
+const (
+	mergeUpToDate = "up_to_date"
+	mergeUpdated  = "updated"
+	mergeMerged   = "merged"
+	mergeConflict = "conflict"
+	mergeResolved = "resolved"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Merge the changes of the instance into the local files",
+	Long: `The command merges the changes made on the instance since the last download into the local files,
+using the contents of the last download as the common base. Files without local changes are simply updated.
+If both sides changed the same lines, the file is written with conflict markers and the upload of the field
+is refused until the conflicts are resolved. Edit the file and run the command with the resolved flag afterwards.
+Providing fields is optional, if you do not provide any, every tracked field of the entry is merged.
+The given fields are not merged if other tracked fields of the entry were changed on the instance as well.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := conf.GetConfig()
+
+		tableName, err := cmd.Flags().GetString("table")
+
+		if err != nil {
+			conf.Err("Parsing error table flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(tableName) == 0 {
+			conf.Err("Please provide a valid table flag!", log.Fields{"error": errors.New("invalid_table")}, true)
+		}
+
+		sysID, err := cmd.Flags().GetString("sys_id")
+
+		if err != nil {
+			conf.Err("Parsing error sys_id flag!", log.Fields{"error": err}, true)
+		}
+
+		if len(sysID) != 32 {
+			conf.Err("Please provide a valid sys_id flag!", log.Fields{"error": errors.New("invalid_sys_id")}, true)
+		}
+
+		fields, err := cmd.Flags().GetString("fields")
+
+		if err != nil {
+			conf.Err("Parsing error fields flag!", log.Fields{"error": err}, true)
+		}
+
+		resolved, err := cmd.Flags().GetBool("resolved")
+
+		if err != nil {
+			conf.Err("Parsing error resolved flag!", log.Fields{"error": err}, true)
+		}
+
+		// get table configuration from the config file
+		tablesConfig := config.Get("app.tables").([]interface{})
+
+		found, entry := db.QueryEntry(tableName, sysID)
+
+		if !found {
+			conf.Err("The entry could not be found! Please download it first!", log.Fields{"error": errors.New("entry_not_found"), "table": tableName, "sys_id": sysID}, true)
+		}
+
+		entryFields, err := db.QueryEntryFields(entry.ID)
+
+		if err != nil {
+			conf.Err("Could not query the fields of the entry!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+		}
+
+		var fieldsSlice []string
+
+		if len(fields) > 0 {
+			fieldsSlice = strings.Split(fields, ",")
+		} else {
+			for fieldName := range entryFields {
+				fieldsSlice = append(fieldsSlice, fieldName)
+			}
+
+			// merge and print the fields in a predictable order
+			sort.Strings(fieldsSlice)
+		}
+
+		for _, fieldName := range fieldsSlice {
+			if _, tracked := entryFields[fieldName]; !tracked {
+				conf.Err("The field was not downloaded yet! Please re-download the entry!", log.Fields{"error": errors.New("field_not_tracked"), "table": tableName, "sys_id": sysID, "field": fieldName}, true)
+			}
+		}
+
+		var results map[string]string
+
+		if resolved {
+			results, err = resolveConflicts(tablesConfig, entry, entryFields, fieldsSlice)
+		} else {
+			results, err = mergeEntry(cmd.Context(), tablesConfig, entry, entryFields, fieldsSlice)
+		}
+
+		if err != nil {
+			conf.Err("There was an error while merging the entry!", log.Fields{"error": err, "table": tableName, "sys_id": sysID}, true)
+		}
+
+		if outputJSON, _ := cmd.Flags().GetBool("json"); outputJSON {
+			log.WithFields(log.Fields{"table": tableName, "sys_id": sysID, "fields": results}).Info("Merge finished!")
+			return
+		}
+
+		for _, fieldName := range fieldsSlice {
+			fmt.Printf("%s: %s\n", fieldName, results[fieldName])
+		}
+	},
+}
+
+// mergeEntry merges the current values of the instance into the local files of the fields
+// and returns the outcome for every field
+func mergeEntry(ctx context.Context, tablesConfig []interface{}, entry db.Entry, entryFields map[string]db.EntryField, fieldsSlice []string) (map[string]string, error) {
+	results := map[string]string{}
+
+	trackedFields := make([]string, 0, len(entryFields))
+
+	for fieldName := range entryFields {
+		trackedFields = append(trackedFields, fieldName)
+	}
+
+	sort.Strings(trackedFields)
+
+	result, err := requestEntry(ctx, entry.TableName, entry.SysID, requestFields(trackedFields))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the update counters of the record are moved forward afterwards, a remote change
+	// of a field which is not merged would be hidden and overwritten by the next upload
+	var unmerged []string
+
+	for _, fieldName := range trackedFields {
+		if conf.ContainsField(fieldsSlice, fieldName) {
+			continue
+		}
+
+		remoteContent, err := dyno.GetString(result, fieldName)
+
+		if err != nil {
+			conf.Err("Invalid key!", log.Fields{"error": err, "field": fieldName}, false)
+			return nil, err
+		}
+
+		if file.Hash([]byte(remoteContent)) != entryFields[fieldName].Hash {
+			unmerged = append(unmerged, fieldName)
+		}
+	}
+
+	if len(unmerged) > 0 {
+		err = errors.New("partial_merge")
+		conf.Err("Other fields of the entry were changed on the instance as well! Merge them together with the given fields.", log.Fields{"error": err, "table": entry.TableName, "sys_id": entry.SysID, "fields": strings.Join(unmerged, ",")}, false)
+		return nil, err
+	}
+
+	for _, fieldName := range fieldsSlice {
+		field := entryFields[fieldName]
+
+		remoteContent, err := dyno.GetString(result, fieldName)
+
+		if err != nil {
+			conf.Err("Invalid key!", log.Fields{"error": err, "field": fieldName}, false)
+			return nil, err
+		}
+
+		directoryPath := file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, entry.UniqueKey)
+		filePath := fieldPath(tablesConfig, entry.TableName, directoryPath, fieldName)
+
+		localContent, err := readField(tablesConfig, entry.TableName, directoryPath, fieldName, field.Base)
+
+		if err != nil {
+			conf.Err("File read error! Please check permissions!", log.Fields{"error": err, "file": filePath}, false)
+			return nil, err
+		}
+
+		localChanged := file.Hash(localContent) != field.Hash
+		remoteChanged := file.Hash([]byte(remoteContent)) != field.Hash
+
+		if !remoteChanged {
+			results[fieldName] = mergeUpToDate
+			continue
+		}
+
+		contents := []byte(remoteContent)
+		conflict := false
+		results[fieldName] = mergeUpdated
+
+		if localChanged {
+			// fields with a format are merged line by line in their pretty-printed form, like the files show them
+			merged, hasConflict := diff.Merge(mergeLines(tablesConfig, entry.TableName, fieldName, []byte(field.Base)), mergeLines(tablesConfig, entry.TableName, fieldName, localContent), mergeLines(tablesConfig, entry.TableName, fieldName, []byte(remoteContent)), "local", "remote")
+			contents = []byte(strings.Join(merged, ""))
+			conflict = hasConflict
+			results[fieldName] = mergeMerged
+
+			if conflict {
+				results[fieldName] = mergeConflict
+			}
+
+			// the merged value is stored like the instance stores it, the file is pretty-printed again
+			if fieldFormat := conf.GetFieldFormat(tablesConfig, entry.TableName, fieldName); len(fieldFormat) > 0 && !conflict {
+				if compacted, err := format.Compact(fieldFormat, contents); err == nil {
+					contents = compacted
+				}
+			}
+		}
+
+		err = writeField(tablesConfig, entry.TableName, directoryPath, fieldName, contents)
+
+		if err != nil {
+			conf.Err("File write error! Please check permissions!", log.Fields{"error": err, "file": filePath}, false)
+			return nil, err
+		}
+
+		// the value of the instance is the new base, the merged local changes are uploaded later
+		err = db.WriteEntryField(entry.TableName, entry.SysID, fieldName, file.Hash([]byte(remoteContent)), remoteContent)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if conflict {
+			err = db.WriteEntryFieldConflict(entry.ID, fieldName, true)
+
+			if err != nil {
+				return nil, err
+			}
+
+			log.WithFields(log.Fields{"file": filePath}).Warn("The file contains conflicts, resolve them and run merge with the resolved flag!")
+		}
+	}
+
+	// the instance changes are incorporated, an upload will not overwrite them anymore
+	return results, writeEntryRemote(entry.TableName, entry.SysID, result)
+}
+
+// mergeLines returns the lines of a value as they are shown in the file of the field
+func mergeLines(tablesConfig []interface{}, tableName string, fieldName string, value []byte) []string {
+	return diff.SplitLines(string(fieldFileContents(tablesConfig, tableName, fieldName, value)))
+}
+
+// resolveConflicts clears the conflict flag of the fields whose files do not contain conflict markers anymore
+func resolveConflicts(tablesConfig []interface{}, entry db.Entry, entryFields map[string]db.EntryField, fieldsSlice []string) (map[string]string, error) {
+	results := map[string]string{}
+
+	for _, fieldName := range fieldsSlice {
+		if !entryFields[fieldName].Conflict {
+			results[fieldName] = mergeUpToDate
+			continue
+		}
+
+		directoryPath := file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, entry.UniqueKey)
+		filePath := fieldPath(tablesConfig, entry.TableName, directoryPath, fieldName)
+
+		content, err := readField(tablesConfig, entry.TableName, directoryPath, fieldName, entryFields[fieldName].Base)
+
+		if err != nil {
+			conf.Err("File read error! Please check permissions!", log.Fields{"error": err, "file": filePath}, false)
+			return nil, err
+		}
+
+		if diff.HasConflictMarkers(string(content)) {
+			err = errors.New("unresolved_conflict")
+			conf.Err("The file still contains conflict markers!", log.Fields{"error": err, "file": filePath}, false)
+			return nil, err
+		}
+
+		err = db.WriteEntryFieldConflict(entry.ID, fieldName, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		results[fieldName] = mergeResolved
+	}
+
+	return results, nil
+}
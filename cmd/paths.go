@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/file"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// trackedField is the entry and field a local file belongs to
+type trackedField struct {
+	Entry db.Entry
+	Field db.EntryField
+}
+
+// entryFields are the fields of one entry resolved from local paths
+type entryFields struct {
+	Entry  db.Entry
+	Fields []string
+}
+
+// the directory of the entry is shared with the table or another entry, it is not moved or removed
+var (
+	errInvalidEntryDirectory = errors.New("invalid_entry_directory")
+	errSharedEntryDirectory  = errors.New("shared_entry_directory")
+)
+
+// checkEntryDirectory refuses a directory which does not belong to the entry alone, before it is moved or removed.
+// A unique key which is empty without its special characters (or like "..") does not give the entry a directory of
+// its own, the path would be the directory of the table. Different unique keys may also end up in the same directory.
+func checkEntryDirectory(entry db.Entry) error {
+	directoryPath := filepath.Clean(file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, entry.UniqueKey))
+	tableDirectory := filepath.Dir(filepath.Clean(file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, "entry")))
+
+	if len(strings.TrimSpace(file.FilterSpecialChars(entry.UniqueKey))) == 0 || filepath.Dir(directoryPath) != tableDirectory {
+		return errInvalidEntryDirectory
+	}
+
+	entries, err := db.ListEntries()
+
+	if err != nil {
+		return err
+	}
+
+	for _, other := range entries {
+		if other.ID != entry.ID && filepath.Clean(file.GenerateDirectoryPath(other.TableName, other.ScopeName, other.UniqueKey)) == directoryPath {
+			return errSharedEntryDirectory
+		}
+	}
+
+	return nil
+}
+
+// resolvePaths maps files and directories of the local layout back to their entries and fields.
+// A directory resolves to the changed field files of the entries below it. The entries are returned
+// in the order of the paths, files which do not belong to a downloaded entry are an error.
+func resolvePaths(tablesConfig []interface{}, paths []string) ([]entryFields, error) {
+	entries, err := db.ListEntries()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the layout of every downloaded entry, by the absolute path of the field files
+	files := map[string][]trackedField{}
+
+	for _, entry := range entries {
+		for _, fieldName := range entryFileFields(tablesConfig, entry.TableName) {
+			filePath, err := filepath.Abs(entryFieldPath(tablesConfig, entry.TableName, entry.ScopeName, entry.UniqueKey, fieldName))
+
+			if err != nil {
+				return nil, err
+			}
+
+			files[filePath] = append(files[filePath], trackedField{Entry: entry, Field: db.EntryField{Name: fieldName}})
+		}
+	}
+
+	var result []entryFields
+	positions := map[int64]int{}
+
+	add := func(tracked trackedField) {
+		position, found := positions[tracked.Entry.ID]
+
+		if !found {
+			position = len(result)
+			positions[tracked.Entry.ID] = position
+			result = append(result, entryFields{Entry: tracked.Entry})
+		}
+
+		if !conf.ContainsField(result[position].Fields, tracked.Field.Name) {
+			result[position].Fields = append(result[position].Fields, tracked.Field.Name)
+		}
+	}
+
+	for _, path := range paths {
+		absolutePath, err := filepath.Abs(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Stat(absolutePath)
+
+		if err != nil {
+			conf.Err("Could not find the path!", log.Fields{"error": err, "path": path}, false)
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			trackedFiles, found := files[absolutePath]
+
+			if !found {
+				err = errors.New("path_not_tracked")
+				conf.Err("The file does not belong to a downloaded entry! Please download the entry first!", log.Fields{"error": err, "path": path}, false)
+				return nil, err
+			}
+
+			for _, tracked := range trackedFiles {
+				add(tracked)
+			}
+
+			continue
+		}
+
+		found := false
+
+		err = filepath.Walk(absolutePath, func(walkPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// skip hidden files and directories like .git
+			if strings.HasPrefix(info.Name(), ".") && walkPath != absolutePath {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if trackedFiles, isField := files[walkPath]; isField && !info.IsDir() {
+				found = true
+
+				// only the changed fields of a directory are uploaded
+				for _, tracked := range trackedFiles {
+					changed, err := changedFields(tablesConfig, tracked.Entry, []string{tracked.Field.Name})
+
+					if err != nil {
+						return err
+					}
+
+					if len(changed) > 0 {
+						add(tracked)
+					}
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			conf.Err("Error while walking the directory!", log.Fields{"error": err, "path": path}, false)
+			return nil, err
+		}
+
+		if !found {
+			err = errors.New("path_not_tracked")
+			conf.Err("The directory does not contain files of a downloaded entry!", log.Fields{"error": err, "path": path}, false)
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/file"
+	"github.com/spf13/cobra"
+)
+
+// prunedEntry is a downloaded entry which does not exist on the instance anymore
+type prunedEntry struct {
+	Table     string `json:"table"`
+	SysID     string `json:"sys_id"`
+	Name      string `json:"name"`
+	Directory string `json:"directory"`
+	Removed   bool   `json:"removed"`
+	Kept      string `json:"kept,omitempty"`
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Find the downloaded entries which were deleted on the instance",
+	Long: `The command checks every downloaded entry against the instance and reports the entries which do not exist anymore.
+With the apply flag the local directories and the database state of these entries are removed.
+Entries the user can not read anymore (for example because of an ACL) are reported as deleted as well,
+so entries with local changes which were not uploaded are kept, unless the force flag is set.
+Entries whose directory does not belong to them alone (shared with another entry or the table) are always kept.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := conf.GetConfig()
+		rootDirectory := config.GetString("app.core.root_directory")
+
+		apply, err := cmd.Flags().GetBool("apply")
+
+		if err != nil {
+			conf.Err("Parsing error apply flag!", log.Fields{"error": err}, true)
+		}
+
+		force, err := cmd.Flags().GetBool("force")
+
+		if err != nil {
+			conf.Err("Parsing error force flag!", log.Fields{"error": err}, true)
+		}
+
+		tablesConfig := config.Get("app.tables").([]interface{})
+		deleted, err := findDeletedEntries(cmd.Context())
+
+		if err != nil {
+			conf.Err("Could not check the entries on the instance!", log.Fields{"error": err}, true)
+		}
+
+		pruned := []prunedEntry{}
+
+		for _, entry := range deleted {
+			directoryPath := file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, entry.UniqueKey)
+			prunedEntry := prunedEntry{Table: entry.TableName, SysID: entry.SysID, Name: entry.UniqueKey, Directory: relativePath(rootDirectory, directoryPath)}
+
+			if apply {
+				prunedEntry.Kept, err = keepEntry(tablesConfig, entry, force)
+
+				if err != nil {
+					conf.Err("Could not check the local state of the entry!", log.Fields{"error": err, "table": entry.TableName, "sys_id": entry.SysID}, true)
+				}
+			}
+
+			if apply && len(prunedEntry.Kept) == 0 {
+				err = removeEntry(entry)
+
+				if err != nil {
+					conf.Err("Could not remove the entry!", log.Fields{"error": err, "table": entry.TableName, "sys_id": entry.SysID}, true)
+				}
+
+				prunedEntry.Removed = true
+			}
+
+			pruned = append(pruned, prunedEntry)
+		}
+
+		if outputJSON, _ := cmd.Flags().GetBool("json"); outputJSON {
+			log.WithFields(log.Fields{"entries": pruned, "applied": apply}).Info("Prune finished!")
+			return
+		}
+
+		if len(pruned) == 0 {
+			fmt.Println("Every downloaded entry exists on the instance!")
+			return
+		}
+
+		if apply {
+			fmt.Println("Entries deleted on the instance, removed unless kept:")
+		} else {
+			fmt.Println("Entries deleted on the instance (use the apply flag to remove them):")
+		}
+
+		for _, entry := range pruned {
+			if len(entry.Kept) > 0 {
+				fmt.Printf("    %s (%s %s) kept: %s\n", entry.Directory, entry.Table, entry.SysID, entry.Kept)
+				continue
+			}
+
+			fmt.Printf("    %s (%s %s)\n", entry.Directory, entry.Table, entry.SysID)
+		}
+	},
+}
+
+// keepEntry returns why the entry is not removed: its directory does not belong to it alone,
+// or its files were changed since the last download (ignored with force)
+func keepEntry(tablesConfig []interface{}, entry db.Entry, force bool) (string, error) {
+	err := checkEntryDirectory(entry)
+
+	switch err {
+	case nil:
+	case errInvalidEntryDirectory, errSharedEntryDirectory:
+		return err.Error(), nil
+	default:
+		return "", err
+	}
+
+	if force {
+		return "", nil
+	}
+
+	changed, err := localChanges(tablesConfig, entry)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(changed) > 0 {
+		return "local_changes", nil
+	}
+
+	return "", nil
+}
+
+// findDeletedEntries requests the downloaded entries of every table in batches
+// and returns the entries which were not returned by the instance
+func findDeletedEntries(ctx context.Context) ([]db.Entry, error) {
+	entries, err := db.ListEntries()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tableNames []string
+	entriesByTable := map[string][]db.Entry{}
+
+	for _, entry := range entries {
+		if _, found := entriesByTable[entry.TableName]; !found {
+			tableNames = append(tableNames, entry.TableName)
+		}
+
+		entriesByTable[entry.TableName] = append(entriesByTable[entry.TableName], entry)
+	}
+
+	var deleted []db.Entry
+
+	for _, tableName := range tableNames {
+		sysIDs := []string{}
+
+		for _, entry := range entriesByTable[tableName] {
+			sysIDs = append(sysIDs, entry.SysID)
+		}
+
+		log.WithFields(log.Fields{"table": tableName, "entries": len(sysIDs)}).Info("Checking the entries on the instance")
+
+		remoteRecords, err := requestEntries(ctx, tableName, sysIDs, []string{"sys_id"})
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entriesByTable[tableName] {
+			if _, found := remoteRecords[entry.SysID]; !found {
+				deleted = append(deleted, entry)
+			}
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,442 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/icza/dyno"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/api"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/worker"
+	"github.com/spf13/cobra"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Download every entry matching a query or belonging to a scope from servicenow",
+	Long: `You can download every entry of a table that matches an encoded query from the instance.
+Alternatively provide a scope and sn-edit will look up every application file of the scope in sys_metadata
+and download the entries of every class which is configured in the config file. Classes which are not
+configured are skipped and reported. The entries are requested page by page and written to the same
+location the download command would use. At the end a summary of the downloaded and failed entries is reported,
+the command fails if any of the entries could not be downloaded.
+With the incremental flag only the entries updated since the last successful pull are downloaded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := conf.GetConfig()
+
+		tableName, err := cmd.Flags().GetString("table")
+
+		if err != nil {
+			conf.Err("Parsing error table flag!", log.Fields{"error": err}, true)
+		}
+
+		encodedQuery, err := cmd.Flags().GetString("encoded_query")
+
+		if err != nil {
+			conf.Err("Parsing error encoded_query flag!", log.Fields{"error": err}, true)
+		}
+
+		scopeName, err := cmd.Flags().GetString("scope")
+
+		if err != nil {
+			conf.Err("Parsing error scope flag!", log.Fields{"error": err}, true)
+		}
+
+		// either a whole scope or the entries of a table can be pulled
+		if len(scopeName) > 0 && (len(tableName) > 0 || len(encodedQuery) > 0) {
+			conf.Err("The scope flag can not be combined with the table or encoded_query flags!", log.Fields{"error": errors.New("invalid_flag_combination")}, true)
+		}
+
+		if len(scopeName) == 0 {
+			if len(tableName) == 0 {
+				conf.Err("Please provide a valid table flag!", log.Fields{"error": errors.New("invalid_table")}, true)
+			}
+
+			if len(encodedQuery) == 0 {
+				conf.Err("Please provide a valid encoded_query flag!", log.Fields{"error": errors.New("invalid_encoded_query_flag")}, true)
+			}
+		}
+
+		pageSize, err := cmd.Flags().GetInt64("page_size")
+
+		if err != nil {
+			conf.Err("Parsing error page_size flag!", log.Fields{"error": err}, true)
+		}
+
+		if pageSize <= 0 {
+			conf.Err("Please provide a valid page_size flag!", log.Fields{"error": errors.New("invalid_page_size_flag")}, true)
+		}
+
+		incremental, err := cmd.Flags().GetBool("incremental")
+
+		if err != nil {
+			conf.Err("Parsing error incremental flag!", log.Fields{"error": err}, true)
+		}
+
+		// get table configuration from the config file
+		tablesConfig := config.Get("app.tables").([]interface{})
+
+		concurrency := getConcurrency(cmd)
+
+		if len(scopeName) > 0 {
+			report, skipped, err := pullScope(cmd.Context(), tablesConfig, scopeName, pageSize, incremental, concurrency)
+
+			if err != nil {
+				conf.Err("There was an error while pulling the entries!", log.Fields{"error": err, "scope": scopeName, "downloaded": len(report.Succeeded), "failed": report.Errors(), "skipped": skipped}, true)
+			}
+
+			if len(report.Failed) > 0 {
+				conf.Err("Some of the entries could not be downloaded!", log.Fields{"error": errors.New("pull_failed"), "scope": scopeName, "downloaded": len(report.Succeeded), "failed": report.Errors(), "skipped": skipped}, true)
+			}
+
+			log.WithFields(log.Fields{"scope": scopeName, "downloaded": len(report.Succeeded), "failed": report.Errors(), "skipped": skipped}).Info("Pull finished!")
+			return
+		}
+
+		if !conf.ContainsField(conf.GetTableNames(tablesConfig), tableName) {
+			conf.Err("The table is not configured, please add it to the config file first!", log.Fields{"error": errors.New("table_not_configured"), "table": tableName}, true)
+		}
+
+		report, err := pullTable(cmd.Context(), tablesConfig, tableName, encodedQuery, pageSize, incremental, concurrency)
+
+		if err != nil {
+			conf.Err("There was an error while pulling the entries!", log.Fields{"error": err, "table": tableName, "downloaded": len(report.Succeeded), "failed": report.Errors()}, true)
+		}
+
+		if len(report.Failed) > 0 {
+			conf.Err("Some of the entries could not be downloaded!", log.Fields{"error": errors.New("pull_failed"), "table": tableName, "downloaded": len(report.Succeeded), "failed": report.Errors()}, true)
+		}
+
+		log.WithFields(log.Fields{"table": tableName, "downloaded": len(report.Succeeded), "failed": report.Errors()}).Info("Pull finished!")
+	},
+}
+
+// pullTable pages through the table API and saves every record matching the encoded query.
+// The records of a page are saved by at most concurrency workers at once. It returns the
+// report of the saved entries and an error if one of the pages could not be requested.
+// With incremental set, only the records updated since the last successful sync of the
+// same query are requested.
+func pullTable(ctx context.Context, tablesConfig []interface{}, tableName string, encodedQuery string, pageSize int64, incremental bool, concurrency int) (worker.Report, error) {
+	report := worker.Report{}
+
+	// get the fields for the table in question on the CLI
+	fields := conf.GetTableFieldNames(tablesConfig, tableName)
+
+	// enforce sys_id and scope if not present already
+	fields = conf.EnforceFields(tablesConfig, tableName, fields)
+
+	watermark := ""
+	watermarkMutex := sync.Mutex{}
+
+	handler := func(records []interface{}) error {
+		tasks := []worker.Task{}
+
+		for _, record := range records {
+			record := record
+			sysID, _ := dyno.GetString(record, "sys_id")
+
+			tasks = append(tasks, worker.Task{Name: sysID, Run: func() error {
+				err := saveEntry(ctx, tablesConfig, tableName, fields, record)
+
+				if err != nil {
+					return err
+				}
+
+				// the timestamps are compared as strings, the format sorts chronologically
+				if sysUpdatedOn, err := dyno.GetString(record, "sys_updated_on"); err == nil {
+					watermarkMutex.Lock()
+					if sysUpdatedOn > watermark {
+						watermark = sysUpdatedOn
+					}
+					watermarkMutex.Unlock()
+				}
+
+				log.WithFields(log.Fields{"table_name": tableName, "sys_id": sysID}).Debug("Entry successfully downloaded!")
+
+				return nil
+			}})
+		}
+
+		report.Merge(worker.Run(ctx, concurrency, tasks))
+
+		return nil
+	}
+
+	var err error
+
+	if incremental {
+		since := ""
+
+		if found, previous := db.QuerySyncWatermark(tableName, encodedQuery); found {
+			log.WithFields(log.Fields{"table": tableName, "sys_updated_on": previous}).Info("Requesting the entries updated since the last sync")
+			since = previous
+		}
+
+		err = requestUpdatedPages(ctx, tableName, encodedQuery, since, requestFields(fields), pageSize, handler)
+	} else {
+		err = requestPages(ctx, tableName, encodedQuery, requestFields(fields), pageSize, handler)
+	}
+
+	if err != nil {
+		return report, err
+	}
+
+	// only advance the watermark if every page and entry was synced
+	if len(report.Failed) == 0 && len(watermark) > 0 {
+		err = db.WriteSyncWatermark(tableName, encodedQuery, watermark)
+
+		if err != nil {
+			conf.Err("Could not write the sync watermark to the database!", log.Fields{"error": err, "table": tableName}, false)
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// pullScope enumerates the sys_metadata records of the scope and pulls every class
+// which is configured in the tables config. The classes which are not configured
+// are returned together with the number of records found for them.
+func pullScope(ctx context.Context, tablesConfig []interface{}, scopeName string, pageSize int64, incremental bool, concurrency int) (worker.Report, map[string]int, error) {
+	report := worker.Report{}
+	skipped := map[string]int{}
+	classes := map[string]int{}
+
+	scopeQuery := "sys_scope.scope=" + scopeName
+
+	log.WithFields(log.Fields{"scope": scopeName}).Info("Enumerating the application files of the scope")
+
+	err := requestPages(ctx, "sys_metadata", scopeQuery, []string{"sys_id", "sys_class_name"}, pageSize, func(records []interface{}) error {
+		for _, record := range records {
+			className, err := dyno.GetString(record, "sys_class_name")
+
+			if err != nil {
+				conf.Err("Invalid key!", log.Fields{"error": err}, false)
+				return err
+			}
+
+			classes[className]++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return report, skipped, err
+	}
+
+	tableNames := conf.GetTableNames(tablesConfig)
+
+	// pull the classes in a predictable order
+	classNames := make([]string, 0, len(classes))
+
+	for className := range classes {
+		classNames = append(classNames, className)
+	}
+
+	sort.Strings(classNames)
+
+	for _, className := range classNames {
+		count := classes[className]
+
+		if !conf.ContainsField(tableNames, className) {
+			skipped[className] = count
+			log.WithFields(log.Fields{"class": className, "entries": count}).Warn("The class is not configured, skipping!")
+			continue
+		}
+
+		log.WithFields(log.Fields{"class": className, "entries": count}).Info("Pulling the entries of the class")
+
+		tableReport, err := pullTable(ctx, tablesConfig, className, scopeQuery+"^sys_class_name="+className, pageSize, incremental, concurrency)
+
+		report.Merge(tableReport)
+
+		if err != nil {
+			return report, skipped, err
+		}
+	}
+
+	return report, skipped, nil
+}
+
+// requestPages requests the records of a table matching the encoded query page by page
+// and passes every page to the handler, until the last page is reached
+func requestPages(ctx context.Context, tableName string, encodedQuery string, fields []string, pageSize int64, handler func(records []interface{}) error) error {
+	config := conf.GetConfig()
+
+	// a stable order is needed, otherwise the pages may overlap
+	query := "ORDERBYsys_id"
+
+	if len(encodedQuery) > 0 {
+		query = encodedQuery + "^" + query
+	}
+
+	for offset := int64(0); ; offset += pageSize {
+		pageURL := fmt.Sprintf("%s/api/now/table/%s?sysparm_query=%s&sysparm_fields=%s&sysparm_limit=%d&sysparm_offset=%d", config.GetString("app.core.rest.url"), tableName, url.QueryEscape(query), strings.Join(fields, ","), pageSize, offset)
+
+		log.WithFields(log.Fields{"table": tableName, "offset": offset, "limit": pageSize}).Info("Requesting a page of entries from the instance")
+
+		records, err := requestPage(ctx, pageURL)
+
+		if err != nil {
+			return err
+		}
+
+		err = handler(records)
+
+		if err != nil {
+			return err
+		}
+
+		// the last page is reached if the instance returned less than requested
+		if int64(len(records)) < pageSize {
+			return nil
+		}
+	}
+}
+
+// requestUpdatedPages requests the records of a table matching the encoded query and updated at or after since
+// (every record if since is empty) in the order they were updated and passes every page to the handler.
+// Instead of an offset every page continues after the last record read, records updated during the sync move
+// to the end and are read again, so no record is skipped when the result shifts.
+func requestUpdatedPages(ctx context.Context, tableName string, encodedQuery string, since string, fields []string, pageSize int64, handler func(records []interface{}) error) error {
+	config := conf.GetConfig()
+
+	// the records read with the sys_updated_on of the last record read, the next page starts with them again
+	seen := map[string]bool{}
+
+	for {
+		query := "ORDERBYsys_updated_on^ORDERBYsys_id"
+
+		if len(since) > 0 {
+			query = "sys_updated_on>=" + since + "^" + query
+		}
+
+		if len(encodedQuery) > 0 {
+			query = encodedQuery + "^" + query
+		}
+
+		// the records read already are skipped, at least a page of new ones is requested
+		limit := pageSize + int64(len(seen))
+		pageURL := fmt.Sprintf("%s/api/now/table/%s?sysparm_query=%s&sysparm_fields=%s&sysparm_limit=%d", config.GetString("app.core.rest.url"), tableName, url.QueryEscape(query), strings.Join(fields, ","), limit)
+
+		log.WithFields(log.Fields{"table": tableName, "sys_updated_on": since, "limit": limit}).Info("Requesting a page of entries from the instance")
+
+		records, err := requestPage(ctx, pageURL)
+
+		if err != nil {
+			return err
+		}
+
+		page := []interface{}{}
+
+		for _, record := range records {
+			sysID, _ := dyno.GetString(record, "sys_id")
+			sysUpdatedOn, _ := dyno.GetString(record, "sys_updated_on")
+
+			if sysUpdatedOn == since && seen[sysID] {
+				continue
+			}
+
+			// the records are ordered by sys_updated_on, the earlier ones are not requested again
+			if sysUpdatedOn != since {
+				since = sysUpdatedOn
+				seen = map[string]bool{}
+			}
+
+			seen[sysID] = true
+			page = append(page, record)
+		}
+
+		err = handler(page)
+
+		if err != nil {
+			return err
+		}
+
+		// the last page is reached if the instance returned less than requested
+		if int64(len(records)) < limit {
+			return nil
+		}
+	}
+}
+
+// requestPage requests one page of records from the table API
+func requestPage(ctx context.Context, pageURL string) ([]interface{}, error) {
+	log.WithFields(log.Fields{"api_url": pageURL}).Debug()
+
+	response, err := api.Get(ctx, pageURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response == nil {
+		return nil, errors.New("empty_response")
+	}
+
+	// unmarshal response
+	var responseResult map[string]interface{}
+	err = json.Unmarshal(response, &responseResult)
+
+	if err != nil {
+		conf.Err("There was an error while unmarshalling the response!", log.Fields{"error": err}, false)
+		return nil, err
+	}
+
+	records, err := dyno.GetSlice(responseResult, "result")
+
+	if err != nil {
+		conf.Err("Invalid key!", log.Fields{"error": err}, false)
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// requestEntries requests the given records of a table in batches by their sys_ids
+// and returns them by sys_id, records missing on the instance are not returned
+func requestEntries(ctx context.Context, tableName string, sysIDs []string, fields []string) (map[string]interface{}, error) {
+	batchSize := 100
+	records := map[string]interface{}{}
+
+	if !conf.ContainsField(fields, "sys_id") {
+		fields = append([]string{"sys_id"}, fields...)
+	}
+
+	for start := 0; start < len(sysIDs); start += batchSize {
+		end := start + batchSize
+
+		if end > len(sysIDs) {
+			end = len(sysIDs)
+		}
+
+		err := requestPages(ctx, tableName, "sys_idIN"+strings.Join(sysIDs[start:end], ","), fields, int64(batchSize), func(page []interface{}) error {
+			for _, record := range page {
+				sysID, err := dyno.GetString(record, "sys_id")
+
+				if err != nil {
+					conf.Err("Invalid key!", log.Fields{"error": err}, false)
+					return err
+				}
+
+				records[sysID] = record
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return records, err
+		}
+	}
+
+	return records, nil
+}
@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-resty/resty/v2"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tableServer answers the table API requests of the pulls from its records, it filters them by
+// the conditions of the encoded query, orders them by sys_updated_on and sys_id and applies the limit
+type tableServer struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	records []map[string]interface{}
+	queries []string
+	limits  []int64
+	// afterRequest is called after every answered request, for example to update a record during the sync
+	afterRequest func(request int)
+}
+
+// the pulls are stopped after this many requests, instead of looping forever
+const maxTableRequests = 50
+
+func newTableServer(records ...map[string]interface{}) *tableServer {
+	server := &tableServer{records: records}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+
+		query := r.URL.Query().Get("sysparm_query")
+		limit, _ := strconv.ParseInt(r.URL.Query().Get("sysparm_limit"), 10, 64)
+		server.queries = append(server.queries, query)
+		server.limits = append(server.limits, limit)
+
+		if len(server.queries) > maxTableRequests {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		result := []map[string]interface{}{}
+
+		for _, record := range server.records {
+			if matchesQuery(record, query) {
+				result = append(result, record)
+			}
+		}
+
+		sort.Slice(result, func(i, j int) bool {
+			if result[i]["sys_updated_on"] != result[j]["sys_updated_on"] {
+				return result[i]["sys_updated_on"].(string) < result[j]["sys_updated_on"].(string)
+			}
+
+			return result[i]["sys_id"].(string) < result[j]["sys_id"].(string)
+		})
+
+		if int64(len(result)) > limit {
+			result = result[:limit]
+		}
+
+		body, _ := json.Marshal(map[string]interface{}{"result": result})
+		_, _ = w.Write(body)
+
+		if server.afterRequest != nil {
+			server.afterRequest(len(server.queries))
+		}
+	}))
+
+	return server
+}
+
+// matchesQuery supports the conditions used by the pulls, field=value and sys_updated_on>=value
+func matchesQuery(record map[string]interface{}, query string) bool {
+	for _, condition := range strings.Split(query, "^") {
+		switch {
+		case strings.HasPrefix(condition, "ORDERBY"):
+		case strings.HasPrefix(condition, "sys_updated_on>="):
+			if record["sys_updated_on"].(string) < strings.TrimPrefix(condition, "sys_updated_on>=") {
+				return false
+			}
+		case strings.Contains(condition, "="):
+			parts := strings.SplitN(condition, "=", 2)
+
+			if record[parts[0]] != parts[1] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func testRecord(sysID string, sysUpdatedOn string) map[string]interface{} {
+	return map[string]interface{}{
+		"sys_id":           sysID,
+		"sys_name":         "name_" + sysID,
+		"sys_updated_on":   sysUpdatedOn,
+		"sys_mod_count":    "1",
+		"sys_scope.name":   "x_test",
+		"sys_scope.sys_id": "scope",
+		"script":           "// " + sysID,
+	}
+}
+
+func setupPull(url string) {
+	config := viper.New()
+	config.Set("app.core.rest.url", url)
+	config.Set("app.core.rest.retry.attempts", 1)
+	conf.SetConfig(config)
+	conf.SetClient(resty.New())
+}
+
+// collectUpdatedPages runs requestUpdatedPages against the server and returns the sys_ids of every page
+func collectUpdatedPages(t *testing.T, server *tableServer, encodedQuery string, since string, pageSize int64) [][]string {
+	pages := [][]string{}
+
+	err := requestUpdatedPages(context.Background(), "sys_script", encodedQuery, since, []string{"sys_id", "sys_updated_on"}, pageSize, func(records []interface{}) error {
+		page := []string{}
+
+		for _, record := range records {
+			page = append(page, record.(map[string]interface{})["sys_id"].(string))
+		}
+
+		pages = append(pages, page)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("requestUpdatedPages() error = %v after %d requests", err, len(server.queries))
+	}
+
+	return pages
+}
+
+func TestRequestUpdatedPages(t *testing.T) {
+	tests := []struct {
+		name         string
+		records      []map[string]interface{}
+		encodedQuery string
+		since        string
+		pageSize     int64
+		pages        [][]string
+		queries      []string
+		limits       []int64
+	}{
+		{
+			name:     "every record once",
+			records:  []map[string]interface{}{testRecord("a", "2020-01-01 10:00:00"), testRecord("b", "2020-01-02 10:00:00"), testRecord("c", "2020-01-03 10:00:00")},
+			pageSize: 2,
+			pages:    [][]string{{"a", "b"}, {"c"}},
+			queries:  []string{"ORDERBYsys_updated_on^ORDERBYsys_id", "sys_updated_on>=2020-01-02 10:00:00^ORDERBYsys_updated_on^ORDERBYsys_id"},
+			limits:   []int64{2, 3},
+		},
+		{
+			name:         "updated since the watermark",
+			records:      []map[string]interface{}{testRecord("a", "2020-01-01 10:00:00"), testRecord("b", "2020-01-02 10:00:00"), testRecord("c", "2020-01-03 10:00:00")},
+			encodedQuery: "sys_scope.name=x_test",
+			since:        "2020-01-02 10:00:00",
+			pageSize:     5,
+			pages:        [][]string{{"b", "c"}},
+			queries:      []string{"sys_scope.name=x_test^sys_updated_on>=2020-01-02 10:00:00^ORDERBYsys_updated_on^ORDERBYsys_id"},
+			limits:       []int64{5},
+		},
+		{
+			name:     "equal timestamps across the page boundary",
+			records:  []map[string]interface{}{testRecord("a", "2020-01-01 10:00:00"), testRecord("b", "2020-01-02 10:00:00"), testRecord("c", "2020-01-02 10:00:00"), testRecord("d", "2020-01-02 10:00:00"), testRecord("e", "2020-01-03 10:00:00")},
+			pageSize: 2,
+			pages:    [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+			queries:  []string{"ORDERBYsys_updated_on^ORDERBYsys_id", "sys_updated_on>=2020-01-02 10:00:00^ORDERBYsys_updated_on^ORDERBYsys_id", "sys_updated_on>=2020-01-02 10:00:00^ORDERBYsys_updated_on^ORDERBYsys_id"},
+			// the records read with the last timestamp are requested again, the limit grows with them
+			limits: []int64{2, 3, 5},
+		},
+		{
+			name:     "more equal timestamps than the page size",
+			records:  []map[string]interface{}{testRecord("a", "2020-01-01 10:00:00"), testRecord("b", "2020-01-01 10:00:00"), testRecord("c", "2020-01-01 10:00:00"), testRecord("d", "2020-01-01 10:00:00"), testRecord("e", "2020-01-01 10:00:00")},
+			pageSize: 2,
+			pages:    [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+			limits:   []int64{2, 4, 6},
+		},
+		{
+			name:     "last page of records read already",
+			records:  []map[string]interface{}{testRecord("a", "2020-01-01 10:00:00"), testRecord("b", "2020-01-01 10:00:00")},
+			pageSize: 2,
+			pages:    [][]string{{"a", "b"}, {}},
+			limits:   []int64{2, 4},
+		},
+		{
+			name:     "no records",
+			pageSize: 2,
+			pages:    [][]string{{}},
+			limits:   []int64{2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTableServer(test.records...)
+			defer server.Close()
+			setupPull(server.URL)
+
+			pages := collectUpdatedPages(t, server, test.encodedQuery, test.since, test.pageSize)
+
+			if !reflect.DeepEqual(pages, test.pages) {
+				t.Errorf("requestUpdatedPages() pages = %v, want %v", pages, test.pages)
+			}
+
+			if test.queries != nil && !reflect.DeepEqual(server.queries, test.queries) {
+				t.Errorf("requestUpdatedPages() queries = %q, want %q", server.queries, test.queries)
+			}
+
+			if !reflect.DeepEqual(server.limits, test.limits) {
+				t.Errorf("requestUpdatedPages() limits = %v, want %v", server.limits, test.limits)
+			}
+		})
+	}
+}
+
+func TestRequestUpdatedPagesUpdatedDuringSync(t *testing.T) {
+	server := newTableServer(testRecord("a", "2020-01-01 10:00:00"), testRecord("b", "2020-01-02 10:00:00"), testRecord("c", "2020-01-03 10:00:00"), testRecord("d", "2020-01-04 10:00:00"))
+	defer server.Close()
+	setupPull(server.URL)
+
+	// a record of the first page is updated while the next page is requested, it moves to the end
+	server.afterRequest = func(request int) {
+		if request == 1 {
+			server.records[0]["sys_updated_on"] = "2020-01-05 10:00:00"
+		}
+	}
+
+	pages := collectUpdatedPages(t, server, "", "", 2)
+	want := [][]string{{"a", "b"}, {"c", "d"}, {"a"}}
+
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("requestUpdatedPages() pages = %v, want %v", pages, want)
+	}
+}
+
+// setupPullDatabase connects a new database and a root directory, the table and the scope of the test records are known
+func setupPullDatabase(t *testing.T, url string) func() {
+	directory, err := ioutil.TempDir("", "sn-edit-pull")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setupPull(url)
+
+	// the initialisation of the database is written to the config file
+	config := conf.GetConfig()
+	config.SetConfigFile(filepath.Join(directory, "sn-edit.yaml"))
+	config.Set("app.core.db.path", filepath.Join(directory, "sn-edit.db"))
+	config.Set("app.core.root_directory", filepath.Join(directory, "root"))
+
+	conf.ConnectDB()
+	conf.BuildTables()
+	conf.MigrateTables()
+
+	if err := db.WriteScope("scope", "x_test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the table is written from its sys_db_object record
+	tableServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result": [{"sys_id": "table", "name": "sys_script", "sys_scope.sys_id": "scope", "sys_scope.name": "x_test"}]}`))
+	}))
+	defer tableServer.Close()
+
+	config.Set("app.core.rest.url", tableServer.URL)
+
+	if err := db.WriteTable(context.Background(), "sys_script"); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Set("app.core.rest.url", url)
+
+	return func() {
+		_ = conf.GetDB().Close()
+		_ = os.RemoveAll(directory)
+	}
+}
+
+func TestPullTableWatermark(t *testing.T) {
+	server := newTableServer(testRecord("a", "2020-01-01 10:00:00"), testRecord("b", "2020-01-02 10:00:00"))
+	defer server.Close()
+	defer setupPullDatabase(t, server.URL)()
+
+	tablesConfig := []interface{}{map[interface{}]interface{}{
+		"name":       "sys_script",
+		"unique_key": "sys_name",
+		"fields":     []interface{}{map[interface{}]interface{}{"field": "script", "extension": "js"}},
+	}}
+
+	pull := func(want string, failed int) {
+		t.Helper()
+
+		server.queries = nil
+		report, err := pullTable(context.Background(), tablesConfig, "sys_script", "", 10, true, 2)
+
+		if err != nil || len(report.Failed) != failed {
+			t.Fatalf("pullTable() = %d failed, %v, want %d failed", len(report.Failed), err, failed)
+		}
+
+		if found, watermark := db.QuerySyncWatermark("sys_script", ""); found != (len(want) > 0) || watermark != want {
+			t.Fatalf("the watermark after the pull = %q, want %q", watermark, want)
+		}
+	}
+
+	// the scope of b is not known, the watermark is not written while an entry is missing
+	server.records[1]["sys_scope.sys_id"] = "unknown"
+	pull("", 1)
+
+	server.records[1]["sys_scope.sys_id"] = "scope"
+	pull("2020-01-02 10:00:00", 0)
+
+	// the next pull continues at the watermark, it stays there while a new entry fails
+	server.records = append(server.records, testRecord("c", "2020-01-03 10:00:00"))
+	server.records[2]["sys_scope.sys_id"] = "unknown"
+	pull("2020-01-02 10:00:00", 1)
+
+	if !strings.HasPrefix(server.queries[0], "sys_updated_on>=2020-01-02 10:00:00^") {
+		t.Errorf("pullTable() query = %q, want the records updated since the watermark", server.queries[0])
+	}
+
+	server.records[2]["sys_scope.sys_id"] = "scope"
+	pull("2020-01-03 10:00:00", 0)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/mbndr/figlet4go"
 	"github.com/mitchellh/go-homedir"
@@ -11,8 +12,11 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
+	"time"
 )
 
 var (
@@ -89,12 +93,50 @@ func initConfig() {
 	conf.ConnectDB()
 	// setup database
 	conf.BuildTables()
+	// apply the schema changes of newer versions
+	conf.MigrateTables()
 	// setup http client that we will use throughout the app
 	api.SetupClient()
 }
 
+// the number of parallel requests for bulk operations, the flag
+// takes precedence over the config file, defaults to sequential
+func getConcurrency(cmd *cobra.Command) int {
+	concurrency, err := cmd.Flags().GetInt("concurrency")
+
+	if err != nil {
+		conf.Err("Parsing error concurrency flag!", log.Fields{"error": err}, true)
+	}
+
+	if concurrency > 0 {
+		return concurrency
+	}
+
+	if concurrency = conf.GetConfig().GetInt("app.core.rest.concurrency"); concurrency > 0 {
+		return concurrency
+	}
+
+	return 1
+}
+
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the first interrupt cancels the running requests and lets the current file writes finish,
+	// the second one exits immediately
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-interrupts
+		log.Warn("Cancelling, finishing the current file writes... Press Ctrl-C again to exit immediately!")
+		cancel()
+		<-interrupts
+		os.Exit(1)
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		er(err)
 	}
 }
@@ -120,14 +162,23 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.sn-edit.yaml)")
 	// json output formatting
 	rootCmd.PersistentFlags().BoolP("json", "", false, "set this if you want sn-edit to output json to stdout")
+	// parallel requests for bulk operations
+	rootCmd.PersistentFlags().IntP("concurrency", "", 0, "the number of entries processed in parallel by bulk operations (default is app.core.rest.concurrency or 1)")
 	// download command flags
 	downloadEntryCmd.Flags().StringP("table", "t", "", "the table from where sn-edit should get the entry from")
 	downloadEntryCmd.Flags().StringP("sys_id", "", "", "the sys_id of the entry which you would like to get")
+	// pull command flags
+	pullCmd.Flags().StringP("table", "t", "", "the table from where sn-edit should get the entries from")
+	pullCmd.Flags().StringP("encoded_query", "", "", "the encoded query the entries should match (example: \"sys_scope.scope=x_acme_app\")")
+	pullCmd.Flags().StringP("scope", "", "", "the name of the scope, every configured class of the application will be downloaded (example: \"x_acme_app\")")
+	pullCmd.Flags().BoolP("incremental", "", false, "only download the entries updated since the last successful pull")
+	pullCmd.Flags().Int64P("page_size", "", 100, "the number of entries requested from the instance at once")
 	// upload command flags
 	uploadEntryCmd.Flags().StringP("table", "t", "", "the table from where sn-edit should get the entry from")
-	uploadEntryCmd.Flags().StringP("sys_id", "", "", "the sys_id of the entry which you would like to get")
+	uploadEntryCmd.Flags().StringP("sys_id", "", "", "the sys_id of the entry which you would like to upload, provide more comma separated to upload several entries of the table")
 	uploadEntryCmd.Flags().StringP("fields", "f", "", "provide one or more fields, comma separated (example: \"name,script,active\")")
-	uploadEntryCmd.Flags().StringP("update_set", "", "", "the sys_id of an update set, you need to list the update sets before using this (example: \"<sys_id>\")")
+	uploadEntryCmd.Flags().BoolP("force", "", false, "upload even if the entry was changed on the instance since the last download")
+	uploadEntryCmd.Flags().StringP("update_set", "", "", "the sys_id of an update set, you need to list the update sets before using this, defaults to the current update set of the scope loaded by the updateset --list command (example: \"<sys_id>\")")
 	// update set flags
 	updateSetCmd.Flags().BoolP("list", "", false, "list update sets for the scope provided")
 	updateSetCmd.Flags().BoolP("set", "", false, "set update sets for the scope provided")
@@ -142,10 +193,52 @@ func init() {
 	searchCmd.Flags().StringP("fields", "", "", "comma separated list of field names, if existent will be merged with tableconfig fields for this table")
 	searchCmd.Flags().StringP("encoded_query", "", "", "the encoded query we should use when searching")
 	searchCmd.Flags().Int64P("limit", "", 1, "limit of the records that are returned from the API")
+	// diff flags
+	diffCmd.Flags().StringP("table", "t", "", "the table of the entry")
+	diffCmd.Flags().StringP("sys_id", "", "", "the sys_id of the entry which you would like to compare")
+	diffCmd.Flags().StringP("fields", "f", "", "provide one or more fields, comma separated (example: \"name,script,active\")")
+	// merge flags
+	mergeCmd.Flags().StringP("table", "t", "", "the table of the entry")
+	mergeCmd.Flags().StringP("sys_id", "", "", "the sys_id of the entry which you would like to merge")
+	mergeCmd.Flags().StringP("fields", "f", "", "provide one or more fields, comma separated (example: \"name,script,active\")")
+	mergeCmd.Flags().BoolP("resolved", "", false, "mark the conflicts of the fields as resolved after editing the files")
+	// status flags
+	statusCmd.Flags().BoolP("local", "", false, "only compare the files with the last download, without requesting the instance")
+	// create flags
+	createCmd.Flags().StringP("table", "t", "", "the table of the new entry")
+	createCmd.Flags().StringP("scope", "", "", "the scope of the new entry (example: \"x_acme_app\")")
+	createCmd.Flags().StringP("update_set", "", "", "the sys_id of an update set, defaults to the current update set of the scope loaded by the updateset --list command (example: \"<sys_id>\")")
+	// copy flags
+	copyCmd.Flags().StringP("table", "t", "", "the table of the source entry")
+	copyCmd.Flags().StringP("sys_id", "", "", "the sys_id of the source entry")
+	copyCmd.Flags().StringArrayP("set", "", []string{}, "override a field of the copy, can be repeated (example: \"name=NewName\")")
+	copyCmd.Flags().StringP("scope", "", "", "the scope of the copy, defaults to the scope of the source entry (example: \"x_acme_app\")")
+	copyCmd.Flags().StringP("update_set", "", "", "the sys_id of an update set, defaults to the current update set of the scope loaded by the updateset --list command (example: \"<sys_id>\")")
+	// delete flags
+	deleteCmd.Flags().StringP("table", "t", "", "the table of the entry")
+	deleteCmd.Flags().StringP("sys_id", "", "", "the sys_id of the entry which you would like to delete")
+	deleteCmd.Flags().StringP("update_set", "", "", "the sys_id of an update set, defaults to the current update set of the scope loaded by the updateset --list command (example: \"<sys_id>\")")
+	deleteCmd.Flags().BoolP("yes", "y", false, "delete without asking for confirmation")
+	deleteCmd.Flags().BoolP("force", "", false, "delete even if the local files of the entry were changed since the last download")
+	// prune flags
+	pruneCmd.Flags().BoolP("apply", "", false, "remove the local directories of the entries deleted on the instance")
+	pruneCmd.Flags().BoolP("force", "", false, "remove the entries even if their local files were changed since the last download")
+	// watch flags
+	watchCmd.Flags().DurationP("debounce", "", 500*time.Millisecond, "wait until the file was not saved for this duration before uploading it")
+	watchCmd.Flags().BoolP("force", "", false, "upload even if the entry was changed on the instance since the last download")
 	//rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(downloadEntryCmd)
+	rootCmd.AddCommand(pullCmd)
 	rootCmd.AddCommand(uploadEntryCmd)
 	rootCmd.AddCommand(updateSetCmd)
 	rootCmd.AddCommand(executeScriptsCmd)
 	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(mergeCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(createCmd)
+	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(pruneCmd)
+	rootCmd.AddCommand(copyCmd)
 }
@@ -89,7 +89,7 @@ to search have to be present in the config file previous of using this command.`
 
 		log.WithFields(log.Fields{"url": searchURL}).Debug("Requesting url!")
 
-		response, err := api.Get(searchURL)
+		response, err := api.Get(cmd.Context(), searchURL)
 
 		if err != nil {
 			conf.Err("There was an error while making the request!", log.Fields{"error": err}, true)
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/icza/dyno"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/file"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	statusUnchanged      = "unchanged"
+	statusModifiedLocal  = "modified_local"
+	statusModifiedRemote = "modified_remote"
+	statusConflict       = "conflict"
+	statusUntracked      = "untracked"
+	statusDeleted        = "deleted"
+)
+
+// fileStatus is the state of one file in the root directory
+type fileStatus struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Table  string `json:"table,omitempty"`
+	SysID  string `json:"sys_id,omitempty"`
+	Field  string `json:"field,omitempty"`
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which files were changed locally or on the instance",
+	Long: `The command walks through the root directory and compares every file with the contents
+of the last download and the current state of the entry on the instance. Every file is reported as
+unchanged, modified locally, modified on the instance, conflicting (modified on both sides), untracked
+or deleted. Use the local flag to skip the requests to the instance.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := conf.GetConfig()
+
+		local, err := cmd.Flags().GetBool("local")
+
+		if err != nil {
+			conf.Err("Parsing error local flag!", log.Fields{"error": err}, true)
+		}
+
+		// get table configuration from the config file
+		tablesConfig := config.Get("app.tables").([]interface{})
+
+		statuses, err := collectStatus(cmd.Context(), tablesConfig, !local)
+
+		if err != nil {
+			conf.Err("Could not determine the status of the files!", log.Fields{"error": err}, true)
+		}
+
+		if outputJSON, _ := cmd.Flags().GetBool("json"); outputJSON {
+			log.WithFields(log.Fields{"files": statuses}).Info("Status of the files!")
+			return
+		}
+
+		printStatus(statuses)
+	},
+}
+
+// collectStatus compares the tracked fields with the local files and optionally with the instance,
+// the files in the root directory which do not belong to a tracked field are reported as untracked
+func collectStatus(ctx context.Context, tablesConfig []interface{}, checkRemote bool) ([]fileStatus, error) {
+	config := conf.GetConfig()
+	rootDirectory := config.GetString("app.core.root_directory")
+
+	entries, err := db.ListEntries()
+
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []fileStatus{}
+	tracked := map[string]bool{}
+	entriesByTable := map[string][]db.Entry{}
+	fieldsByTable := map[string][]string{}
+	entryFields := map[int64]map[string]db.EntryField{}
+
+	for _, entry := range entries {
+		fields, err := db.QueryEntryFields(entry.ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entryFields[entry.ID] = fields
+		entriesByTable[entry.TableName] = append(entriesByTable[entry.TableName], entry)
+
+		for fieldName := range fields {
+			if !conf.ContainsField(fieldsByTable[entry.TableName], fieldName) {
+				fieldsByTable[entry.TableName] = append(fieldsByTable[entry.TableName], fieldName)
+			}
+		}
+	}
+
+	for tableName, tableEntries := range entriesByTable {
+		remoteRecords := map[string]interface{}{}
+
+		if checkRemote {
+			sysIDs := []string{}
+
+			for _, entry := range tableEntries {
+				sysIDs = append(sysIDs, entry.SysID)
+			}
+
+			remoteRecords, err = requestEntries(ctx, tableName, sysIDs, requestFields(fieldsByTable[tableName]))
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, entry := range tableEntries {
+			record, remoteFound := remoteRecords[entry.SysID]
+			recordChanged := remoteFound && remoteRecordChanged(entry, record)
+
+			for fieldName, field := range entryFields[entry.ID] {
+				directoryPath := file.GenerateDirectoryPath(tableName, entry.ScopeName, entry.UniqueKey)
+				filePath := fieldPath(tablesConfig, tableName, directoryPath, fieldName)
+				tracked[filePath] = true
+
+				status := fileStatus{Path: relativePath(rootDirectory, filePath), Status: statusUnchanged, Table: tableName, SysID: entry.SysID, Field: fieldName}
+
+				// the fields of the record file share one file
+				if conf.IsRecordField(tablesConfig, tableName, fieldName) {
+					status.Path = status.Path + ":" + fieldName
+				}
+
+				content, err := readField(tablesConfig, tableName, directoryPath, fieldName, field.Base)
+
+				if err != nil {
+					if !os.IsNotExist(err) {
+						conf.Err("File read error! Please check permissions!", log.Fields{"error": err, "file": filePath}, false)
+						return nil, err
+					}
+
+					status.Status = statusDeleted
+					statuses = append(statuses, status)
+					continue
+				}
+
+				localChanged := file.Hash(content) != field.Hash
+				remoteChanged := false
+
+				if recordChanged {
+					remoteContent, err := dyno.GetString(record, fieldName)
+					remoteChanged = err == nil && file.Hash([]byte(remoteContent)) != field.Hash
+				}
+
+				switch {
+				case field.Conflict, localChanged && remoteChanged:
+					status.Status = statusConflict
+				case localChanged:
+					status.Status = statusModifiedLocal
+				case remoteChanged:
+					status.Status = statusModifiedRemote
+				}
+
+				statuses = append(statuses, status)
+			}
+		}
+	}
+
+	// every other file in the root directory is untracked
+	err = filepath.Walk(rootDirectory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// skip hidden files and directories like .git
+		if strings.HasPrefix(info.Name(), ".") && path != rootDirectory {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.IsDir() && !tracked[path] {
+			statuses = append(statuses, fileStatus{Path: relativePath(rootDirectory, path), Status: statusUntracked})
+		}
+
+		return nil
+	})
+
+	if err != nil && !os.IsNotExist(err) {
+		conf.Err("Error while walking the root directory!", log.Fields{"error": err, "directory": rootDirectory}, false)
+		return nil, err
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Path < statuses[j].Path
+	})
+
+	return statuses, nil
+}
+
+// remoteRecordChanged compares the update counters of the instance with the ones of the last download
+func remoteRecordChanged(entry db.Entry, record interface{}) bool {
+	sysUpdatedOn, _ := dyno.GetString(record, "sys_updated_on")
+	sysModCount, _ := dyno.GetString(record, "sys_mod_count")
+
+	return sysUpdatedOn != entry.SysUpdatedOn || sysModCount != strconv.FormatInt(entry.SysModCount, 10)
+}
+
+func relativePath(rootDirectory string, path string) string {
+	relative, err := filepath.Rel(rootDirectory, path)
+
+	if err != nil {
+		return path
+	}
+
+	return relative
+}
+
+func printStatus(statuses []fileStatus) {
+	groups := []struct {
+		status string
+		title  string
+	}{
+		{statusConflict, "Changed locally and on the instance (conflicts)"},
+		{statusModifiedLocal, "Changed locally"},
+		{statusModifiedRemote, "Changed on the instance"},
+		{statusDeleted, "Deleted locally"},
+		{statusUntracked, "Untracked files"},
+	}
+
+	changes := false
+
+	for _, group := range groups {
+		var paths []string
+
+		for _, status := range statuses {
+			if status.Status == group.status {
+				paths = append(paths, status.Path)
+			}
+		}
+
+		if len(paths) == 0 {
+			continue
+		}
+
+		changes = true
+
+		fmt.Printf("%s:\n", group.title)
+
+		for _, path := range paths {
+			fmt.Printf("    %s\n", path)
+		}
+
+		fmt.Print("\n")
+	}
+
+	if !changes {
+		fmt.Println("Everything is up to date!")
+	}
+}
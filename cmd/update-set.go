@@ -66,7 +66,7 @@ Attention: An invalid scope name defaults to global scope. I warned you!`,
 				conf.Err("Please provide a valid sys_id!", log.Fields{"error": errors.New("invalid_sys_id_length")}, true)
 			}
 
-			updateset.SetCommand(scopeName, updateSetSysID)
+			updateset.SetCommand(cmd.Context(), scopeName, updateSetSysID)
 		}
 	},
 }
@@ -22,7 +22,7 @@ func ListCommand(cmd *cobra.Command, scopeName string) {
 		log.WithFields(log.Fields{"message": "scope exists"}).Debug("Scope already exists, no insert!")
 		//return sysID, nil
 	} else {
-		sysID, err = db.RequestScopeDataFromInstance(scopeName)
+		sysID, err = db.RequestScopeDataByName(cmd.Context(), scopeName)
 
 		if err != nil {
 			return
@@ -106,7 +106,7 @@ func ListCommand(cmd *cobra.Command, scopeName string) {
 	// make request to the instance (to get an updated list of scopes for the scope in the CLI)
 	listUpdateSetEndpoint := config.GetString("app.core.rest.url") + "/api/now/ui/concoursepicker/updateset?sysparm_transaction_scope=" + sysID
 
-	response, err := api.Get(listUpdateSetEndpoint)
+	response, err := api.Get(cmd.Context(), listUpdateSetEndpoint)
 
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Error("Error during the request to the instance!")
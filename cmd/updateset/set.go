@@ -1,6 +1,7 @@
 package updateset
 
 import (
+	"context"
 	"encoding/json"
 	log "github.com/sirupsen/logrus"
 	"github.com/sn-edit/sn-edit/api"
@@ -8,7 +9,7 @@ import (
 	"github.com/sn-edit/sn-edit/db"
 )
 
-func SetCommand(scopeName string, updateSetSysID string) {
+func SetCommand(ctx context.Context, scopeName string, updateSetSysID string) {
 	config := conf.GetConfig()
 
 	found, scopeID, _ := db.ScopeExists(scopeName)
@@ -42,7 +43,7 @@ func SetCommand(scopeName string, updateSetSysID string) {
 
 	// make request to the instance (to get an updated list of scopes for the scope in the CLI)
 	setUpdateSetEndPoint := config.GetString("app.core.rest.url") + "/api/now/ui/concoursepicker/updateset?sysparm_transaction_scope=" + scopeID
-	_, err = api.Put(setUpdateSetEndPoint, dataJSON)
+	_, err = api.Put(ctx, setUpdateSetEndPoint, dataJSON)
 
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Error("Error while uploading data to the instance!")
@@ -1,25 +1,35 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/icza/dyno"
 	log "github.com/sirupsen/logrus"
 	"github.com/sn-edit/sn-edit/api"
 	"github.com/sn-edit/sn-edit/conf"
 	"github.com/sn-edit/sn-edit/db"
 	"github.com/sn-edit/sn-edit/file"
+	"github.com/sn-edit/sn-edit/worker"
 	"github.com/spf13/cobra"
+	"os"
 	"strings"
 )
 
 var uploadEntryCmd = &cobra.Command{
-	Use:   "upload",
-	Short: "Upload one entry from servicenow",
+	Use:   "upload [paths...]",
+	Short: "Upload one or more entries to servicenow",
 	Long: `You can upload one entry (for example a script) to the instance.
 Provide a table name, sys_id and field please. The table name and fields should be already configured in the config file.
 Otherwise sn-edit will not be able to determine the location or download the data to.
-Providing a field is optional, if you do not provide any, sn-edit will assume you would like to update the contents of every field for the entry saved locally.`,
+Several comma separated sys_ids of the same table can be uploaded at once.
+Instead of the flags you can provide the paths of downloaded files or directories, sn-edit resolves them to the entries and fields.
+A directory uploads the changed field files of the entries in it.
+If an entry was changed on the instance since the last download, the upload is refused unless the force flag is set.
+Without an update set flag, the update set currently selected for the scope of the entry is used (see the updateset --list command),
+the upload is refused if the update sets of the scope were not loaded yet.
+Providing a field is optional, if you do not provide any, sn-edit uploads every field whose file was changed since the last download.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := conf.GetConfig()
 
@@ -29,33 +39,18 @@ Providing a field is optional, if you do not provide any, sn-edit will assume yo
 			conf.Err("Parsing error table flag!", log.Fields{"error": err}, true)
 		}
 
-		if len(tableName) == 0 {
-			conf.Err("Please provide a valid table flag!", log.Fields{"error": errors.New("invalid_table")}, true)
-		}
-
-		sysID, err := cmd.Flags().GetString("sys_id")
+		sysIDs, err := cmd.Flags().GetString("sys_id")
 
 		if err != nil {
 			conf.Err("Parsing error sys_id flag!", log.Fields{"error": err}, true)
 		}
 
-		if len(sysID) != 32 {
-			conf.Err("Please provide a valid sys_id flag!", log.Fields{"error": errors.New("invalid_sys_id")}, true)
-		}
-
 		fields, err := cmd.Flags().GetString("fields")
 
 		if err != nil {
 			conf.Err("Parsing error fields flag!", log.Fields{"error": err}, true)
 		}
 
-		fieldsSlice := strings.Split(fields, ",")
-
-		// if array length is 1, but the first element is an empty string, do not allow processing
-		if len(fieldsSlice) == 1 && fieldsSlice[0] == "" {
-			conf.Err("Please provide a valid fields flag!", log.Fields{"error": errors.New("invalid_fields_flag")}, true)
-		}
-
 		// get the update set name if exists
 		updateSet, err := cmd.Flags().GetString("update_set")
 
@@ -63,73 +58,386 @@ Providing a field is optional, if you do not provide any, sn-edit will assume yo
 			conf.Err("Parsing error update_set flag!", log.Fields{"error": err}, true)
 		}
 
-		if len(updateSet) != 32 {
+		if len(updateSet) > 0 && len(updateSet) != 32 {
 			log.Info("Get a list of sys_id's by calling the updateset --list command!")
 			conf.Err("Please provide a valid update_set flag!", log.Fields{"error": errors.New("invalid_sys_id")}, true)
 		}
 
+		force, err := cmd.Flags().GetBool("force")
+
+		if err != nil {
+			conf.Err("Parsing error force flag!", log.Fields{"error": err}, true)
+		}
+
 		// get table configuration from the config file
 		tablesConfig := config.Get("app.tables").([]interface{})
 
-		// get the fields for the table in question on the CLI
-		configFields := conf.GetTableFieldNames(tablesConfig, tableName)
+		tasks := []worker.Task{}
+
+		if len(args) > 0 {
+			// the paths already determine the entries and fields
+			if len(tableName) > 0 || len(sysIDs) > 0 || len(fields) > 0 {
+				conf.Err("The paths can not be combined with the table, sys_id or fields flags!", log.Fields{"error": errors.New("invalid_flag_combination")}, true)
+			}
+
+			uploads, err := resolvePaths(tablesConfig, args)
+
+			if err != nil {
+				conf.Err("Could not resolve the paths to downloaded entries!", log.Fields{"error": err, "paths": args}, true)
+			}
+
+			if len(uploads) == 0 {
+				log.WithFields(log.Fields{"paths": args}).Info("No file was changed since the last download, nothing to upload!")
+				return
+			}
+
+			for _, upload := range uploads {
+				upload := upload
+				tasks = append(tasks, worker.Task{Name: upload.Entry.TableName + "/" + upload.Entry.SysID, Run: func() error {
+					return uploadEntry(cmd.Context(), tablesConfig, upload.Entry.TableName, upload.Entry.SysID, upload.Fields, updateSet, force)
+				}})
+			}
+		} else {
+			if len(tableName) == 0 {
+				conf.Err("Please provide a valid table flag!", log.Fields{"error": errors.New("invalid_table")}, true)
+			}
+
+			sysIDSlice := strings.Split(sysIDs, ",")
+
+			for _, sysID := range sysIDSlice {
+				if len(sysID) != 32 {
+					conf.Err("Please provide a valid sys_id flag!", log.Fields{"error": errors.New("invalid_sys_id"), "sys_id": sysID}, true)
+				}
+			}
+
+			var fieldsSlice []string
+
+			if len(fields) > 0 {
+				fieldsSlice = strings.Split(fields, ",")
+			}
+
+			for _, sysID := range sysIDSlice {
+				sysID := sysID
+				tasks = append(tasks, worker.Task{Name: tableName + "/" + sysID, Run: func() error {
+					uploadFields := fieldsSlice
 
-		// todo: check if valid fields provided, compare tableconfig with the fieldsSlice
+					// without fields every field changed since the last download is uploaded
+					if len(uploadFields) == 0 {
+						found, entry := db.QueryEntry(tableName, sysID)
 
-		// build data
-		data := make(map[string]interface{})
+						if !found {
+							err := errors.New("entry_not_found")
+							conf.Err("The entry could not be found! Please download it first!", log.Fields{"error": err, "table_name": tableName, "sys_id": sysID}, false)
+							return err
+						}
 
-		found, uniqueKeyName := db.QueryUniqueKey(tableName, sysID)
+						changed, err := changedFields(tablesConfig, entry, entryFileFields(tablesConfig, tableName))
 
-		if !found {
-			conf.Err("Could not find unique_key!", log.Fields{"error": errors.New("unique_key_not_found"), "table_name": tableName, "sys_id": sysID}, true)
+						if err != nil {
+							return err
+						}
+
+						if len(changed) == 0 {
+							log.WithFields(log.Fields{"table": tableName, "sys_id": sysID}).Info("No field was changed since the last download, nothing to upload!")
+							return nil
+						}
+
+						uploadFields = changed
+					}
+
+					return uploadEntry(cmd.Context(), tablesConfig, tableName, sysID, uploadFields, updateSet, force)
+				}})
+			}
 		}
 
-		success, fileScopeName := db.GetEntryScopeName(tableName, sysID)
+		report := worker.Run(cmd.Context(), getConcurrency(cmd), tasks)
 
-		if !success {
-			conf.Err("Could not find scope for entry! Please re-download entry!", log.Fields{"error": errors.New("data_out_of_sync"), "table_name": tableName, "sys_id": sysID}, true)
+		if len(report.Failed) > 0 {
+			conf.Err("Some of the entries could not be uploaded!", log.Fields{"error": errors.New("upload_failed"), "uploaded": len(report.Succeeded), "failed": report.Errors()}, true)
 		}
 
-		// iterate through the cli fields which need updating on the instance
-		for _, cliField := range fieldsSlice {
-			// find the extension based on the field and tableName from the config
-			extension := conf.GetFieldExtension(tablesConfig, tableName, cliField)
-			// generate file path to the given file, full path, to read
-			filePath := file.GenerateFilePath(tableName, fileScopeName, uniqueKeyName, cliField, extension)
-			// get the contents of the file
-			content, err := file.ReadFile(filePath)
+		if len(tasks) > 1 {
+			log.WithFields(log.Fields{"uploaded": len(report.Succeeded), "failed": report.Errors()}).Info("Upload finished!")
+		}
+	},
+}
 
-			if err != nil {
-				conf.Err("File read error! Please check permissions!", log.Fields{"error": err}, true)
-			}
+// uploadEntry reads the given fields of an entry from the local files and updates them on the instance,
+// unless the entry was changed on the instance since the last download and force is not set.
+// Without an update set the current update set of the scope of the entry is used.
+func uploadEntry(ctx context.Context, tablesConfig []interface{}, tableName string, sysID string, fieldsSlice []string, updateSet string, force bool) error {
+	config := conf.GetConfig()
+
+	// get the fields for the table in question on the CLI
+	configFields := conf.GetTableFieldNames(tablesConfig, tableName)
+
+	// todo: check if valid fields provided, compare tableconfig with the fieldsSlice
+
+	// build data
+	data := make(map[string]interface{})
+
+	found, uniqueKeyName := db.QueryUniqueKey(tableName, sysID)
+
+	if !found {
+		err := errors.New("unique_key_not_found")
+		conf.Err("Could not find unique_key!", log.Fields{"error": err, "table_name": tableName, "sys_id": sysID}, false)
+		return err
+	}
+
+	success, fileScopeName := db.GetEntryScopeName(tableName, sysID)
 
-			data[cliField] = string(content)
+	if !success {
+		err := errors.New("data_out_of_sync")
+		conf.Err("Could not find scope for entry! Please re-download entry!", log.Fields{"error": err, "table_name": tableName, "sys_id": sysID}, false)
+		return err
+	}
+
+	// conflict markers of a merge are never uploaded, not even with force
+	err := checkUnresolved(tableName, sysID, fieldsSlice)
+
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		err := checkConflict(ctx, tableName, sysID)
+
+		if err != nil {
+			return err
 		}
+	}
+
+	// the downloaded values tell the original style of the formatted fields
+	_, entry := db.QueryEntry(tableName, sysID)
+	entryFields, err := db.QueryEntryFields(entry.ID)
+
+	if err != nil {
+		return err
+	}
 
-		// marshal into JSON
-		dataJSON, err := json.Marshal(data)
+	// iterate through the cli fields which need updating on the instance
+	for _, cliField := range fieldsSlice {
+		// get the contents of the field, from its own file or from the record file
+		content, err := readField(tablesConfig, tableName, file.GenerateDirectoryPath(tableName, fileScopeName, uniqueKeyName), cliField, entryFields[cliField].Base)
 
 		if err != nil {
-			conf.Err("JSON marshalling error!", log.Fields{"error": err}, true)
+			conf.Err("File read error! Please check permissions!", log.Fields{"error": err}, false)
+			return err
 		}
 
-		// setup the upload url
-		uploadURLv2 := fmt.Sprintf("%s/api/now/table/%s/%s?sysparm_fields=%s&sysparm_scope=%s", config.GetString("app.core.rest.url"), tableName, sysID, strings.Join(configFields, ","), fileScopeName)
+		err = checkFieldFormat(tablesConfig, tableName, cliField, content)
 
-		// if there is an update set passed
-		if len(updateSet) == 32 {
-			uploadURLv2 = uploadURLv2 + "&sysparm_transaction_update_set=" + updateSet
+		if err != nil {
+			return err
 		}
 
-		log.WithFields(log.Fields{"sys_id": sysID, "table": tableName, "fields": fieldsSlice, "scope": fileScopeName}).Info("Uploading data to the instance...")
+		data[cliField] = string(content)
+	}
 
-		_, err = api.Put(uploadURLv2, dataJSON)
+	if len(updateSet) == 0 {
+		updateSet, err = requireCurrentUpdateSet(fileScopeName)
 
 		if err != nil {
-			conf.Err("There was an error while uploading the entry data!", log.Fields{"error": err, "sys_id": sysID, "table": tableName, "fields": fieldsSlice, "scope": fileScopeName}, true)
+			return err
 		}
+	}
 
-		log.WithFields(log.Fields{"sys_id": sysID, "table": tableName, "fields": fieldsSlice, "scope": fileScopeName}).Info("The data was successfully uploaded!")
-	},
+	// marshal into JSON
+	dataJSON, err := json.Marshal(data)
+
+	if err != nil {
+		conf.Err("JSON marshalling error!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	// setup the upload url
+	uploadURLv2 := fmt.Sprintf("%s/api/now/table/%s/%s?sysparm_fields=%s&sysparm_scope=%s", config.GetString("app.core.rest.url"), tableName, sysID, strings.Join(requestFields(configFields), ","), fileScopeName)
+
+	// if there is an update set passed
+	if len(updateSet) == 32 {
+		uploadURLv2 = uploadURLv2 + "&sysparm_transaction_update_set=" + updateSet
+	}
+
+	log.WithFields(log.Fields{"sys_id": sysID, "table": tableName, "fields": fieldsSlice, "scope": fileScopeName}).Info("Uploading data to the instance...")
+
+	response, err := api.Put(ctx, uploadURLv2, dataJSON)
+
+	if err != nil {
+		conf.Err(instanceErrorMessage(err, "There was an error while uploading the entry data!"), log.Fields{"error": err, "sys_id": sysID, "table": tableName, "fields": fieldsSlice, "scope": fileScopeName}, false)
+		return err
+	}
+
+	// the uploaded contents are the new state of the entry on the instance
+	err = writeUploadedState(tableName, sysID, data, response)
+
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"sys_id": sysID, "table": tableName, "fields": fieldsSlice, "scope": fileScopeName}).Info("The data was successfully uploaded!")
+
+	return nil
+}
+
+// writeUploadedState stores the hashes of the uploaded fields and the update counters
+// returned by the instance, so the uploaded files are not reported as changed anymore
+func writeUploadedState(tableName string, sysID string, data map[string]interface{}, response []byte) error {
+	var responseResult map[string]interface{}
+	err := json.Unmarshal(response, &responseResult)
+
+	if err != nil {
+		conf.Err("There was an error while unmarshalling the response!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	result, err := dyno.Get(responseResult, "result")
+
+	if err != nil {
+		conf.Err("Invalid key!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	for fieldName, content := range data {
+		err = db.WriteEntryField(tableName, sysID, fieldName, file.Hash([]byte(content.(string))), content.(string))
+
+		if err != nil {
+			conf.Err("Could not write the field to the database!", log.Fields{"error": err, "field": fieldName}, false)
+			return err
+		}
+	}
+
+	return writeEntryRemote(tableName, sysID, result)
+}
+
+// checkConflict compares the update counters of the instance with the ones stored at the last download,
+// if somebody else changed the entry in the meantime, the upload would overwrite these changes
+func checkConflict(ctx context.Context, tableName string, sysID string) error {
+	found, entry := db.QueryEntry(tableName, sysID)
+
+	if !found {
+		err := errors.New("entry_not_found")
+		conf.Err("The entry could not be found! Please download it first!", log.Fields{"error": err, "table_name": tableName, "sys_id": sysID}, false)
+		return err
+	}
+
+	// entries downloaded with older versions have no counters stored
+	if len(entry.SysUpdatedOn) == 0 {
+		log.WithFields(log.Fields{"table_name": tableName, "sys_id": sysID}).Warn("The entry can not be checked for conflicts! Please re-download it!")
+		return nil
+	}
+
+	result, err := requestEntry(ctx, tableName, sysID, []string{"sys_updated_on", "sys_mod_count", "sys_updated_by"})
+
+	if err != nil {
+		conf.Err("There was an error while checking the entry for conflicts!", log.Fields{"error": err, "table_name": tableName, "sys_id": sysID}, false)
+		return err
+	}
+
+	if !remoteRecordChanged(entry, result) {
+		return nil
+	}
+
+	sysUpdatedOn, _ := dyno.GetString(result, "sys_updated_on")
+	sysUpdatedBy, _ := dyno.GetString(result, "sys_updated_by")
+	sysModCount, _ := dyno.GetString(result, "sys_mod_count")
+
+	err = errors.New("entry_conflict")
+	conf.Err(fmt.Sprintf("The entry was changed on the instance by %s at %s since your last download! Download or merge the changes, or use the force flag to overwrite them!", sysUpdatedBy, sysUpdatedOn), log.Fields{"error": err, "table_name": tableName, "sys_id": sysID, "sys_updated_by": sysUpdatedBy, "sys_updated_on": sysUpdatedOn, "sys_mod_count": sysModCount, "downloaded_sys_updated_on": entry.SysUpdatedOn, "downloaded_sys_mod_count": entry.SysModCount}, false)
+
+	return err
+}
+
+// checkUnresolved refuses the upload of fields with unresolved conflicts of a merge
+func checkUnresolved(tableName string, sysID string, fieldsSlice []string) error {
+	found, entry := db.QueryEntry(tableName, sysID)
+
+	if !found {
+		return nil
+	}
+
+	entryFields, err := db.QueryEntryFields(entry.ID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, fieldName := range fieldsSlice {
+		if entryFields[fieldName].Conflict {
+			err = errors.New("unresolved_conflict")
+			conf.Err("The field has unresolved merge conflicts! Resolve them and run merge with the resolved flag first!", log.Fields{"error": err, "table_name": tableName, "sys_id": sysID, "field": fieldName}, false)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// instanceErrorMessage explains the errors of the instance the user can act on,
+// the message is kept for any other error
+func instanceErrorMessage(err error, message string) string {
+	switch api.ErrorKind(err) {
+	case api.ErrorACLDenied:
+		return message + " The access was denied by an ACL of the instance!"
+	case api.ErrorInvalidUpdateSet:
+		return message + " The update set can not be used, get a list of update sets by calling the updateset --list command!"
+	case api.ErrorUnauthorized:
+		return message + " Please check the credentials in the config file!"
+	}
+
+	return message
+}
+
+// requireCurrentUpdateSet returns the sys_id of the update set selected for the scope. If the update sets of
+// the scope were not loaded yet, the write is refused, it would end up in any update set selected on the instance.
+func requireCurrentUpdateSet(scopeName string) (string, error) {
+	found, sysID, name := db.QueryCurrentUpdateSet(scopeName)
+
+	if !found || len(sysID) != 32 {
+		err := errors.New("unknown_update_set")
+		conf.Err("The current update set of the scope is unknown! Provide the update_set flag or load the update sets of the scope with the updateset --list command!", log.Fields{"error": err, "scope": scopeName}, false)
+		return "", err
+	}
+
+	log.WithFields(log.Fields{"scope": scopeName, "update_set": name}).Debug("Using the current update set of the scope")
+
+	return sysID, nil
+}
+
+// changedFields returns the fields whose files differ from the contents of the last download,
+// fields without a recorded hash are treated as changed, missing files and the sys_id are skipped
+func changedFields(tablesConfig []interface{}, entry db.Entry, fieldsSlice []string) ([]string, error) {
+	entryFields, err := db.QueryEntryFields(entry.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+
+	for _, fieldName := range fieldsSlice {
+		if fieldName == "sys_id" {
+			continue
+		}
+
+		filePath := entryFieldPath(tablesConfig, entry.TableName, entry.ScopeName, entry.UniqueKey, fieldName)
+
+		content, err := readField(tablesConfig, entry.TableName, file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, entry.UniqueKey), fieldName, entryFields[fieldName].Base)
+
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			conf.Err("File read error! Please check permissions!", log.Fields{"error": err, "file": filePath}, false)
+			return nil, err
+		}
+
+		if field, tracked := entryFields[fieldName]; tracked && field.Hash == file.Hash(content) {
+			continue
+		}
+
+		changed = append(changed, fieldName)
+	}
+
+	return changed, nil
 }
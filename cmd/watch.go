@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/sn-edit/sn-edit/db"
+	"github.com/sn-edit/sn-edit/file"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Upload the files to servicenow as soon as they are saved",
+	Long: `The command watches the root directory for changes and uploads every saved file of a downloaded entry
+to the instance. Only the field belonging to the file is uploaded, into the update set currently selected
+for the scope of the entry (see the updateset --list command). Several saves in a short time are uploaded once.
+Failing uploads are logged and the command keeps on watching, stop it with Ctrl-C.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := conf.GetConfig()
+		rootDirectory := config.GetString("app.core.root_directory")
+
+		debounce, err := cmd.Flags().GetDuration("debounce")
+
+		if err != nil {
+			conf.Err("Parsing error debounce flag!", log.Fields{"error": err}, true)
+		}
+
+		if debounce < 0 {
+			conf.Err("Please provide a valid debounce flag!", log.Fields{"error": errors.New("invalid_debounce_flag")}, true)
+		}
+
+		force, err := cmd.Flags().GetBool("force")
+
+		if err != nil {
+			conf.Err("Parsing error force flag!", log.Fields{"error": err}, true)
+		}
+
+		// get table configuration from the config file
+		tablesConfig := config.Get("app.tables").([]interface{})
+
+		watcher, err := fsnotify.NewWatcher()
+
+		if err != nil {
+			conf.Err("Could not start watching the files!", log.Fields{"error": err}, true)
+		}
+
+		defer watcher.Close()
+
+		err = watchDirectory(watcher, rootDirectory)
+
+		if err != nil {
+			conf.Err("Could not watch the root directory!", log.Fields{"error": err, "directory": rootDirectory}, true)
+		}
+
+		index := &entryIndex{tablesConfig: tablesConfig}
+
+		err = index.refresh()
+
+		if err != nil {
+			conf.Err("Could not read the downloaded entries!", log.Fields{"error": err}, true)
+		}
+
+		log.WithFields(log.Fields{"directory": rootDirectory}).Info("Watching for changes...")
+
+		// the timers delay the upload until the file was not saved for the debounce duration
+		timers := map[string]*time.Timer{}
+		saved := make(chan string)
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 || isHidden(rootDirectory, event.Name) {
+					continue
+				}
+
+				// new directories (for example of a new download) have to be watched as well
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					err = watchDirectory(watcher, event.Name)
+
+					if err != nil {
+						conf.Err("Could not watch the directory!", log.Fields{"error": err, "directory": event.Name}, false)
+					}
+
+					continue
+				}
+
+				path := event.Name
+
+				if timer, found := timers[path]; found {
+					timer.Stop()
+				}
+
+				timers[path] = time.AfterFunc(debounce, func() {
+					saved <- path
+				})
+			case path := <-saved:
+				delete(timers, path)
+
+				err := uploadSavedFile(cmd.Context(), tablesConfig, index, path, force)
+
+				if err != nil {
+					log.WithFields(log.Fields{"error": err, "file": relativePath(rootDirectory, path)}).Error("The file could not be uploaded, watching for the next change!")
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				conf.Err("There was an error while watching the files!", log.Fields{"error": err}, false)
+			case <-cmd.Context().Done():
+				log.Info("Stopped watching for changes!")
+				return
+			}
+		}
+	},
+}
+
+// watchDirectory adds the directory and every subdirectory except hidden ones to the watcher
+func watchDirectory(watcher *fsnotify.Watcher, directory string) error {
+	return filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if strings.HasPrefix(info.Name(), ".") && path != directory {
+			return filepath.SkipDir
+		}
+
+		return watcher.Add(path)
+	})
+}
+
+// isHidden reports if the path or one of its parents below the root directory is hidden, like .git
+func isHidden(rootDirectory string, path string) bool {
+	for _, part := range strings.Split(relativePath(rootDirectory, path), string(os.PathSeparator)) {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+// uploadSavedFile uploads the fields of the saved file into the current update set of the scope,
+// files which do not belong to a downloaded entry or were not changed since the last download are skipped
+func uploadSavedFile(ctx context.Context, tablesConfig []interface{}, index *entryIndex, path string, force bool) error {
+	trackedFiles, err := index.lookup(path)
+
+	if err != nil {
+		return err
+	}
+
+	if len(trackedFiles) == 0 {
+		log.WithFields(log.Fields{"file": path}).Debug("The file does not belong to a downloaded entry, skipping!")
+		return nil
+	}
+
+	entry := trackedFiles[0].Entry
+	directoryPath := file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, entry.UniqueKey)
+	var changed []string
+
+	for _, tracked := range trackedFiles {
+		content, err := readField(tablesConfig, entry.TableName, directoryPath, tracked.Field.Name, tracked.Field.Base)
+
+		if err != nil {
+			// editors may remove the file for a moment while saving
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			conf.Err("File read error! Please check permissions!", log.Fields{"error": err, "file": path}, false)
+			return err
+		}
+
+		// writes of downloads and merges do not need to be uploaded
+		if file.Hash(content) != tracked.Field.Hash {
+			changed = append(changed, tracked.Field.Name)
+		}
+	}
+
+	if len(changed) == 0 {
+		log.WithFields(log.Fields{"file": path}).Debug("The file did not change since the last download, skipping!")
+		return nil
+	}
+
+	// without an update set the current update set of the scope is used
+	return uploadEntry(ctx, tablesConfig, entry.TableName, entry.SysID, changed, "", force)
+}
+
+// entryIndex maps the directories of the downloaded entries to the entries, so a save only reads the
+// fields of its own entry. Directories of entries downloaded or moved while watching refresh the index.
+type entryIndex struct {
+	tablesConfig []interface{}
+	directories  map[string][]db.Entry
+}
+
+// refresh reads the directories of every downloaded entry
+func (index *entryIndex) refresh() error {
+	entries, err := db.ListEntries()
+
+	if err != nil {
+		return err
+	}
+
+	index.directories = map[string][]db.Entry{}
+
+	for _, entry := range entries {
+		directoryPath := filepath.Clean(file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, entry.UniqueKey))
+		index.directories[directoryPath] = append(index.directories[directoryPath], entry)
+	}
+
+	return nil
+}
+
+// lookup returns the entry and fields stored in the file, none if it does not belong to a downloaded entry
+func (index *entryIndex) lookup(path string) ([]trackedField, error) {
+	fields, current, err := index.fields(path)
+
+	if err != nil || current {
+		return fields, err
+	}
+
+	err = index.refresh()
+
+	if err != nil {
+		return nil, err
+	}
+
+	fields, _, err = index.fields(path)
+
+	return fields, err
+}
+
+// fields returns the tracked fields stored in the file, current is false if the index does
+// not know the directory of the file or the entry was moved since the index was read
+func (index *entryIndex) fields(path string) ([]trackedField, bool, error) {
+	path = filepath.Clean(path)
+	directoryPath := filepath.Dir(path)
+	entries, found := index.directories[directoryPath]
+
+	if !found {
+		return nil, false, nil
+	}
+
+	var fields []trackedField
+
+	for _, indexed := range entries {
+		found, entry := db.QueryEntry(indexed.TableName, indexed.SysID)
+
+		if !found || filepath.Clean(file.GenerateDirectoryPath(entry.TableName, entry.ScopeName, entry.UniqueKey)) != directoryPath {
+			return nil, false, nil
+		}
+
+		entryFields, err := db.QueryEntryFields(entry.ID)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		for fieldName, field := range entryFields {
+			if filepath.Clean(fieldPath(index.tablesConfig, entry.TableName, directoryPath, fieldName)) == path {
+				fields = append(fields, trackedField{Entry: entry, Field: field})
+			}
+		}
+	}
+
+	return fields, true, nil
+}
@@ -5,10 +5,32 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/icza/dyno"
 	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/format"
 	"github.com/spf13/viper"
 	"os"
 )
 
+// the line endings of the field files, configured in app.core.files.line_endings
+const (
+	LineEndingsKeep = "keep"
+	LineEndingsLF   = "lf"
+	LineEndingsCRLF = "crlf"
+)
+
+// the authentication against the instance, configured in app.core.rest.auth
+const (
+	AuthBasic  = "basic"
+	AuthOAuth  = "oauth"
+	AuthAPIKey = "apikey"
+	AuthBearer = "bearer"
+)
+
+// the OAuth grants requesting the tokens, configured in app.core.rest.oauth.grant_type
+const (
+	GrantPassword          = "password"
+	GrantClientCredentials = "client_credentials"
+)
+
 var conf *viper.Viper
 var restClient *resty.Client
 
@@ -57,20 +79,64 @@ func ValidateConfig() {
 		"app.core.root_directory",
 		"app.core.log_level",
 		"app.core.rest.url",
-		"app.core.rest.user",
-		"app.core.rest.xor_key",
-		"app.core.rest.password",
-		"app.core.rest.masked",
 		"app.core.db.initialised",
 		"app.core.db.path",
 	}
 
+	requiredKeys = append(requiredKeys, authRequiredKeys()...)
+
 	for _, key := range requiredKeys {
 		if !config.IsSet(key) {
 			log.WithFields(log.Fields{"error": fmt.Sprintf("The key %s is required, but could not be found! See the sample file for reference!", key)}).Error("Invalid config file detected!")
 			os.Exit(1)
 		}
 	}
+
+	// the files policy is optional, the files are written as the instance stores the values by default
+	if lineEndings := config.GetString("app.core.files.line_endings"); len(lineEndings) > 0 && lineEndings != LineEndingsKeep && lineEndings != LineEndingsLF && lineEndings != LineEndingsCRLF {
+		log.WithFields(log.Fields{"error": "The key app.core.files.line_endings has to be keep, lf or crlf!", "line_endings": lineEndings}).Error("Invalid config file detected!")
+		os.Exit(1)
+	}
+}
+
+// authRequiredKeys validates the authentication and returns the keys it requires, basic auth is used if
+// none is configured, the user and password are only required by the authentications logging in with them
+func authRequiredKeys() []string {
+	config := GetConfig()
+	credentials := []string{"app.core.rest.user", "app.core.rest.xor_key", "app.core.rest.password", "app.core.rest.masked"}
+
+	switch auth := config.GetString("app.core.rest.auth"); auth {
+	case "", AuthBasic:
+		return credentials
+	case AuthOAuth:
+		// the OAuth client has to be registered on the instance (System OAuth > Application Registry)
+		keys := []string{"app.core.rest.xor_key", "app.core.rest.oauth.client_id", "app.core.rest.oauth.client_secret"}
+
+		switch grantType := config.GetString("app.core.rest.oauth.grant_type"); grantType {
+		case "", GrantPassword:
+			return append(keys, credentials...)
+		case GrantClientCredentials:
+			return keys
+		default:
+			log.WithFields(log.Fields{"error": "The key app.core.rest.oauth.grant_type has to be password or client_credentials!", "grant_type": grantType}).Error("Invalid config file detected!")
+			os.Exit(1)
+		}
+	case AuthAPIKey, AuthBearer:
+		// a token of the config file is masked with the xor key
+		if config.IsSet("app.core.rest.token.value") {
+			return []string{"app.core.rest.xor_key"}
+		}
+
+		if !config.IsSet("app.core.rest.token.env") && !config.IsSet("app.core.rest.token.command") {
+			log.WithFields(log.Fields{"error": "One of the keys app.core.rest.token.value, app.core.rest.token.env or app.core.rest.token.command is required for the " + auth + " authentication!"}).Error("Invalid config file detected!")
+			os.Exit(1)
+		}
+	default:
+		log.WithFields(log.Fields{"error": "The key app.core.rest.auth has to be basic, oauth, apikey or bearer!", "auth": auth}).Error("Invalid config file detected!")
+		os.Exit(1)
+	}
+
+	return nil
 }
 
 // every table should have some fields defined, these fields should have an extension set
@@ -88,14 +154,20 @@ func ValidateTableData() {
 			os.Exit(1)
 		}
 
-		tableFields, err := dyno.Get(table, "fields")
-		fields := tableFields.([]interface{})
+		fields, err := tableFields(table)
 
 		if err != nil {
+			if layoutName, _ := dyno.GetString(table, "layout"); len(layoutName) > 0 {
+				log.WithFields(log.Fields{"error": err, "table": tableName, "layout": layoutName, "layouts": GetLayoutNames()}).Error("The layout of the table does not exist!")
+				os.Exit(1)
+			}
+
 			log.WithFields(log.Fields{"error": err, "table": tableName, "path": "validateTableData.fields"}).Error("Was not able to find the key!")
 			os.Exit(1)
 		}
 
+		recordTable, _ := dyno.GetBoolean(table, "record")
+
 		for _, field := range fields {
 			fieldName, err := dyno.GetString(field, "field")
 
@@ -106,7 +178,8 @@ func ValidateTableData() {
 
 			fieldExtension, err := dyno.GetString(field, "extension")
 
-			if err != nil {
+			// fields of record tables without an extension are stored in the record file
+			if err != nil && !recordTable {
 				log.WithFields(log.Fields{"error": err, "table": tableName, "fieldName": fieldName, "extension": fieldExtension}).Error("Was not able to find the key! Every field does need to have an extension!")
 				os.Exit(1)
 			}
@@ -116,10 +189,20 @@ func ValidateTableData() {
 				os.Exit(1)
 			}
 
-			if len(fieldExtension) == 0 {
+			if len(fieldExtension) == 0 && !recordTable {
 				log.WithFields(log.Fields{"error": "extension", "table": tableName, "fieldName": fieldName, "extension": fieldExtension}).Error("Every field does need to have an extension!")
 				os.Exit(1)
 			}
+
+			if fieldType, err := dyno.GetString(field, "type"); err == nil && fieldType != FieldTypeString && fieldType != FieldTypeBoolean && fieldType != FieldTypeInteger {
+				log.WithFields(log.Fields{"error": "type", "table": tableName, "fieldName": fieldName, "type": fieldType}).Error("The type of a field has to be string, boolean or integer!")
+				os.Exit(1)
+			}
+
+			if fieldFormat, err := dyno.GetString(field, "format"); err == nil && fieldFormat != format.JSON && fieldFormat != format.XML {
+				log.WithFields(log.Fields{"error": "format", "table": tableName, "fieldName": fieldName, "format": fieldFormat}).Error("The format of a field has to be json or xml!")
+				os.Exit(1)
+			}
 		}
 
 	}
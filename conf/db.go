@@ -25,12 +25,15 @@ func ConnectDB() *sql.DB {
 		Err("Please specify a valid database path!", log.Fields{"error": err, "path": path}, true)
 	}
 
-	db, err = sql.Open("sqlite3", "file:"+path+"?cache=shared")
+	db, err = sql.Open("sqlite3", "file:"+path+"?cache=shared&_busy_timeout=5000")
 
 	// Check error for database connection
 	if err != nil {
 		Err("Please specify a valid database path!", log.Fields{"error": err}, true)
 	}
 
+	// sqlite does not support parallel writes, bulk operations share one connection
+	db.SetMaxOpenConns(1)
+
 	return db
 }
@@ -7,11 +7,24 @@ import (
 	"strconv"
 )
 
+// fieldsError is an error with details for the log output, like the errors of the instance
+type fieldsError interface {
+	error
+	Fields() log.Fields
+}
+
 func Err(err interface{}, fields log.Fields, exit bool) {
 
 	// add the original caller from runtime
 	_, fn, line, _ := runtime.Caller(1)
-	log.WithFields(log.Fields{"caller_fn": fn + ":" + strconv.Itoa(line)}).WithFields(fields).Error(err)
+	entry := log.WithFields(log.Fields{"caller_fn": fn + ":" + strconv.Itoa(line)})
+
+	// the details of the error are rendered the same way in the text and the json output
+	if detailed, ok := fields["error"].(fieldsError); ok {
+		entry = entry.WithFields(detailed.Fields())
+	}
+
+	entry.WithFields(fields).Error(err)
 
 	if exit {
 		os.Exit(1)
@@ -1,6 +1,7 @@
 package conf
 
 import (
+	"fmt"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -34,3 +35,64 @@ func BuildTables() {
 		}
 	}
 }
+
+// schema changes applied on top of the initial tables, the number of
+// applied migrations is kept in the user_version of the database
+var migrations = []string{
+	`
+    CREATE TABLE IF NOT EXISTS entry_sync(id integer primary key autoincrement, entry_table integer, query text, sys_updated_on text, last_modified integer, FOREIGN KEY(entry_table) REFERENCES entry_table(id));
+    CREATE INDEX IF NOT EXISTS idx_entry_syncs ON entry_sync(entry_table, query);
+    `,
+	`
+    ALTER TABLE entry ADD COLUMN sys_updated_on text;
+    ALTER TABLE entry ADD COLUMN sys_mod_count integer;
+    CREATE TABLE IF NOT EXISTS entry_field(id integer primary key autoincrement, entry integer, name text, hash text, FOREIGN KEY(entry) REFERENCES entry(id));
+    CREATE INDEX IF NOT EXISTS idx_entry_fields ON entry_field(entry, name);
+    `,
+	`
+    ALTER TABLE entry_field ADD COLUMN base text;
+    ALTER TABLE entry_field ADD COLUMN conflict bool DEFAULT 0;
+    `,
+	`
+    CREATE TABLE IF NOT EXISTS oauth_token(id integer primary key autoincrement, client text, access_token text, refresh_token text, expires_at integer);
+    CREATE INDEX IF NOT EXISTS idx_oauth_tokens ON oauth_token(client);
+    `,
+}
+
+func MigrateTables() {
+	dbc := GetDB()
+
+	version := 0
+	err := dbc.QueryRow("PRAGMA user_version").Scan(&version)
+
+	if err != nil {
+		Err("Could not read the database version!", log.Fields{"error": err}, true)
+	}
+
+	for index := version; index < len(migrations); index++ {
+		log.WithFields(log.Fields{"version": index + 1}).Debug("Migrating the database...")
+
+		tx, err := dbc.Begin()
+
+		if err != nil {
+			Err("Database migration error!", log.Fields{"error": err, "version": index + 1}, true)
+		}
+
+		_, err = tx.Exec(migrations[index])
+
+		if err == nil {
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", index+1))
+		}
+
+		if err != nil {
+			tx.Rollback()
+			Err("Database migration error!", log.Fields{"error": err, "version": index + 1}, true)
+		}
+
+		err = tx.Commit()
+
+		if err != nil {
+			Err("Database migration error!", log.Fields{"error": err, "version": index + 1}, true)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package conf
+
+import (
+	"errors"
+	"github.com/icza/dyno"
+	"github.com/sn-edit/sn-edit/format"
+)
+
+// layout is a built-in set of fields of a table whose records consist of several files
+type layout struct {
+	UniqueKey string
+	Fields    []interface{}
+}
+
+// layouts are the built-in layouts a table can select with the layout key, instead of
+// configuring every field by hand. The extensions tell editors the language of the files.
+var layouts = map[string]layout{
+	"sp_widget": {
+		UniqueKey: "id",
+		Fields: []interface{}{
+			map[string]interface{}{"field": "sys_id", "extension": "txt"},
+			map[string]interface{}{"field": "id", "extension": "txt"},
+			map[string]interface{}{"field": "name", "extension": "txt"},
+			map[string]interface{}{"field": "template", "extension": "html"},
+			map[string]interface{}{"field": "css", "extension": "scss"},
+			map[string]interface{}{"field": "client_script", "extension": "client.js"},
+			map[string]interface{}{"field": "script", "extension": "server.js"},
+			map[string]interface{}{"field": "link", "extension": "client.js"},
+			map[string]interface{}{"field": "option_schema", "extension": "json", "format": format.JSON},
+			map[string]interface{}{"field": "demo_data", "extension": "json", "format": format.JSON},
+		},
+	},
+	"sys_ui_page": {
+		UniqueKey: "name",
+		Fields: []interface{}{
+			map[string]interface{}{"field": "sys_id", "extension": "txt"},
+			map[string]interface{}{"field": "name", "extension": "txt"},
+			map[string]interface{}{"field": "html", "extension": "html", "format": format.XML},
+			map[string]interface{}{"field": "client_script", "extension": "client.js"},
+			map[string]interface{}{"field": "processing_script", "extension": "server.js"},
+		},
+	},
+}
+
+// GetLayoutNames returns the names of the built-in layouts
+func GetLayoutNames() []string {
+	var result []string
+
+	for name := range layouts {
+		result = append(result, name)
+	}
+
+	return result
+}
+
+// tableFields returns the configured fields of a table. With a layout the fields of the layout
+// are used, fields configured for the table replace the layout field of the same name or are added.
+func tableFields(table interface{}) ([]interface{}, error) {
+	layoutName, err := dyno.GetString(table, "layout")
+
+	if err != nil || len(layoutName) == 0 {
+		return dyno.GetSlice(table, "fields")
+	}
+
+	tableLayout, found := layouts[layoutName]
+
+	if !found {
+		return nil, errors.New("layout_not_found")
+	}
+
+	result := append([]interface{}{}, tableLayout.Fields...)
+
+	// the fields are optional for tables with a layout
+	fields, err := dyno.GetSlice(table, "fields")
+
+	if err != nil {
+		return result, nil
+	}
+
+	for _, field := range fields {
+		fieldName, err := dyno.GetString(field, "field")
+
+		if err != nil {
+			return nil, err
+		}
+
+		replaced := false
+
+		for i, layoutField := range result {
+			if layoutFieldName, _ := dyno.GetString(layoutField, "field"); layoutFieldName == fieldName {
+				result[i] = field
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			result = append(result, field)
+		}
+	}
+
+	return result, nil
+}
+
+// tableUniqueKey returns the configured unique key of a table, or the unique key of its layout
+func tableUniqueKey(table interface{}) (string, error) {
+	uniqueKey, err := dyno.GetString(table, "unique_key")
+
+	if err == nil && len(uniqueKey) > 0 {
+		return uniqueKey, nil
+	}
+
+	layoutName, _ := dyno.GetString(table, "layout")
+
+	if tableLayout, found := layouts[layoutName]; found {
+		return tableLayout.UniqueKey, nil
+	}
+
+	if err == nil {
+		err = errors.New("unique_key_not_found")
+	}
+
+	return "", err
+}
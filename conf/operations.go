@@ -5,6 +5,13 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// the types of the fields stored in the record file
+const (
+	FieldTypeString  = "string"
+	FieldTypeBoolean = "boolean"
+	FieldTypeInteger = "integer"
+)
+
 func GetTableNames(tablesConfig []interface{}) []string {
 	var result []string
 	// iterate tables from the configuration file
@@ -34,16 +41,15 @@ func GetTableFieldNames(tablesConfig []interface{}, tableName string) []string {
 		}
 
 		if table == tableName {
-			// get the fields
-			fields, err := dyno.Get(value, "fields")
+			// get the fields, including the fields of the layout
+			fields, err := tableFields(value)
 
 			if err != nil {
 				Err("Invalid key!", log.Fields{"error": err}, false)
 			}
 
-			fieldMap := fields.([]interface{})
 			// now select the field names only
-			for _, field := range fieldMap {
+			for _, field := range fields {
 				fieldName, err := dyno.GetString(field, "field")
 
 				if err != nil {
@@ -69,16 +75,15 @@ func GetFieldExtension(tablesConfig []interface{}, tableName string, fieldName s
 		}
 
 		if table == tableName {
-			// get the fields
-			fields, err := dyno.Get(value, "fields")
+			// get the fields, including the fields of the layout
+			fields, err := tableFields(value)
 
 			if err != nil {
 				Err("Invalid key!", log.Fields{"error": err}, true)
 			}
 
-			fieldMap := fields.([]interface{})
 			// now select the field names only
-			for _, field := range fieldMap {
+			for _, field := range fields {
 				fieldNeedle, err := dyno.GetString(field, "field")
 
 				if err != nil {
@@ -88,7 +93,8 @@ func GetFieldExtension(tablesConfig []interface{}, tableName string, fieldName s
 				if fieldNeedle == fieldName {
 					fieldExtension, err := dyno.GetString(field, "extension")
 
-					if err != nil {
+					// fields of record tables without an extension are stored in the record file
+					if err != nil && !IsRecordTable(tablesConfig, tableName) {
 						Err("Invalid key!", log.Fields{"error": err}, true)
 					}
 
@@ -101,6 +107,78 @@ func GetFieldExtension(tablesConfig []interface{}, tableName string, fieldName s
 	return ""
 }
 
+// IsRecordTable reports if the fields of the table without an extension are stored together
+// in a record file next to the files of the other fields
+func IsRecordTable(tablesConfig []interface{}, tableName string) bool {
+	for _, value := range tablesConfig {
+		table, err := dyno.GetString(value, "name")
+
+		if err != nil {
+			Err("Invalid key!", log.Fields{"error": err}, true)
+		}
+
+		if table == tableName {
+			record, err := dyno.GetBoolean(value, "record")
+			return err == nil && record
+		}
+	}
+
+	return false
+}
+
+// IsRecordField reports if the field is stored in the record file of the entry, that is every field
+// of a record table without an extension, including the enforced fields which are not configured
+func IsRecordField(tablesConfig []interface{}, tableName string, fieldName string) bool {
+	return IsRecordTable(tablesConfig, tableName) && len(GetFieldExtension(tablesConfig, tableName, fieldName)) == 0
+}
+
+// GetFieldType returns the type of the field used in the record file (string, boolean or integer)
+func GetFieldType(tablesConfig []interface{}, tableName string, fieldName string) string {
+	if fieldType := getFieldOption(tablesConfig, tableName, fieldName, "type"); len(fieldType) > 0 {
+		return fieldType
+	}
+
+	return FieldTypeString
+}
+
+// GetFieldFormat returns the format the field is pretty-printed in (json or xml), empty if it is stored as it is
+func GetFieldFormat(tablesConfig []interface{}, tableName string, fieldName string) string {
+	return getFieldOption(tablesConfig, tableName, fieldName, "format")
+}
+
+// getFieldOption returns an optional setting of a configured field, empty if it is not set
+func getFieldOption(tablesConfig []interface{}, tableName string, fieldName string, option string) string {
+	for _, value := range tablesConfig {
+		table, err := dyno.GetString(value, "name")
+
+		if err != nil {
+			Err("Invalid key!", log.Fields{"error": err}, true)
+		}
+
+		if table != tableName {
+			continue
+		}
+
+		fields, err := tableFields(value)
+
+		if err != nil {
+			Err("Invalid key!", log.Fields{"error": err}, true)
+		}
+
+		for _, field := range fields {
+			if fieldNeedle, _ := dyno.GetString(field, "field"); fieldNeedle != fieldName {
+				continue
+			}
+
+			if optionValue, err := dyno.GetString(field, option); err == nil {
+				return optionValue
+			}
+		}
+	}
+
+	return ""
+}
+
 func GetUniqueKeyForTable(tablesConfig []interface{}, tableName string) (string, error) {
 	var uniqueKey string
 	// iterate tables from the configuration file
@@ -113,8 +191,8 @@ func GetUniqueKeyForTable(tablesConfig []interface{}, tableName string) (string,
 		}
 
 		if table == tableName {
-			// get the fields
-			uniqueKey, err = dyno.GetString(value, "unique_key")
+			// get the unique key, the layout of the table may provide it
+			uniqueKey, err = tableUniqueKey(value)
 
 			if err != nil {
 				Err("Invalid key!", log.Fields{"error": err}, true)
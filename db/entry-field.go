@@ -0,0 +1,113 @@
+package db
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+)
+
+// EntryField is the state of a field at the last download
+type EntryField struct {
+	Name string
+	// hash of the contents written to the file
+	Hash string
+	// the value of the field on the instance, the base of a merge
+	Base string
+	// set while the file contains unresolved conflict markers
+	Conflict bool
+}
+
+// stores the hash of the field contents as written to the file and the value received from
+// the instance, so local and remote changes can be detected and merged, clears a conflict
+func WriteEntryField(tableName string, sysID string, fieldName string, hash string, base string) error {
+	dbc := conf.GetDB()
+
+	found, entry := QueryEntry(tableName, sysID)
+
+	if !found {
+		err := errors.New("entry_not_found")
+		log.WithFields(log.Fields{"err": err}).Debug("Entry not found! Please re-download!")
+		return err
+	}
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	result, err := dbc.Exec("UPDATE entry_field SET hash=?, base=?, conflict=0 WHERE entry=? AND name=?", hash, base, entry.ID, fieldName)
+
+	if err != nil {
+		conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	// insert the field on the first download
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		return nil
+	}
+
+	stmt, err := dbc.Prepare("INSERT INTO entry_field(entry, name, hash, base, conflict) VALUES(?,?,?,?,0)")
+
+	if err != nil {
+		conf.Err("There was an error while preparing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(entry.ID, fieldName, hash, base)
+
+	if err != nil {
+		conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	return nil
+}
+
+// flags or clears the unresolved conflict of a field
+func WriteEntryFieldConflict(entryID int64, fieldName string, conflict bool) error {
+	dbc := conf.GetDB()
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	_, err := dbc.Exec("UPDATE entry_field SET conflict=? WHERE entry=? AND name=?", conflict, entryID, fieldName)
+
+	if err != nil {
+		conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	return nil
+}
+
+// returns every tracked field of the entry by the field name
+func QueryEntryFields(entryID int64) (map[string]EntryField, error) {
+	dbc := conf.GetDB()
+
+	rows, err := dbc.Query("SELECT name, hash, IFNULL(base, ''), IFNULL(conflict, 0) FROM entry_field WHERE entry=?", entryID)
+
+	if err != nil {
+		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	fields := map[string]EntryField{}
+
+	for rows.Next() {
+		field := EntryField{}
+
+		err := rows.Scan(&field.Name, &field.Hash, &field.Base, &field.Conflict)
+
+		if err != nil {
+			conf.Err("Error while iterating through the results!", log.Fields{"error": err}, false)
+			return nil, err
+		}
+
+		fields[field.Name] = field
+	}
+
+	return fields, rows.Err()
+}
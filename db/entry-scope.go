@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -15,14 +16,24 @@ func WriteScope(sysID string, scopeName string) error {
 	//config := conf.GetConfig()
 	dbc := conf.GetDB()
 
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	// check if scope exists
+	if exists, _ := QueryScope(sysID); exists == true {
+		log.WithFields(log.Fields{"error": "scope_exists"}).Debug("Scope already exists, no insert!")
+		return nil
+	}
+
 	stmt, err := dbc.Prepare("INSERT INTO entry_scope(sys_id, name) VALUES(?,?)")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("There was an error while preparing the query!", log.Fields{"error": err}, false)
 		return err
 	}
 
+	defer stmt.Close()
+
 	_, err = stmt.Exec(sysID, scopeName)
 
 	if err != nil {
@@ -36,13 +47,14 @@ func WriteScope(sysID string, scopeName string) error {
 func QueryScope(sysID string) (bool, int64) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT id FROM entry_scope WHERE sys_id=? LIMIT 1")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
 		return false, 0
 	}
 
+	defer stmt.Close()
+
 	id := int64(0)
 	err = stmt.QueryRow(sysID).Scan(&id)
 
@@ -63,13 +75,14 @@ func QueryScope(sysID string) (bool, int64) {
 func ScopeExists(scopeName string) (bool, string, string) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT id,sys_id FROM entry_scope WHERE name=? LIMIT 1")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
 		return false, "", ""
 	}
 
+	defer stmt.Close()
+
 	id := ""
 	sysID := ""
 	err = stmt.QueryRow(scopeName).Scan(&id, &sysID)
@@ -91,13 +104,14 @@ func ScopeExists(scopeName string) (bool, string, string) {
 func GetScopeNameFromSysID(sysID string) (bool, string) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT name FROM entry_scope WHERE sys_id=? LIMIT 1")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
 		return false, ""
 	}
 
+	defer stmt.Close()
+
 	name := ""
 	err = stmt.QueryRow(sysID).Scan(&name)
 
@@ -115,10 +129,10 @@ func GetScopeNameFromSysID(sysID string) (bool, string) {
 	return true, name
 }
 
-func RequestScopeData(scopeApiURL string) ([]byte, error) {
+func RequestScopeData(ctx context.Context, scopeApiURL string) ([]byte, error) {
 	// get the table details from REST
 	// setup the table API URL url
-	response, err := api.Get(scopeApiURL)
+	response, err := api.Get(ctx, scopeApiURL)
 
 	if err != nil {
 		return nil, err
@@ -128,19 +142,28 @@ func RequestScopeData(scopeApiURL string) ([]byte, error) {
 }
 
 // returns scope sys_id
-func RequestScopeDataFromInstance(sysScopeSysID string) (string, error) {
+func RequestScopeDataFromInstance(ctx context.Context, sysScopeSysID string) (string, error) {
+	return requestScopeData(ctx, "sys_id="+sysScopeSysID)
+}
+
+// RequestScopeDataByName requests the scope by its name (for example x_acme_app) and returns its sys_id
+func RequestScopeDataByName(ctx context.Context, scopeName string) (string, error) {
+	return requestScopeData(ctx, "scope="+scopeName)
+}
+
+func requestScopeData(ctx context.Context, encodedQuery string) (string, error) {
 	config := conf.GetConfig()
 
 	// fields required here
 	fields := []string{"scope", "sys_id"}
 
-	query := fmt.Sprintf("sysparm_query=sys_id=%s&sysparm_fields=%s", sysScopeSysID, strings.Join(fields, ","))
+	query := fmt.Sprintf("sysparm_query=%s&sysparm_fields=%s", encodedQuery, strings.Join(fields, ","))
 
 	endpoint := config.GetString("app.core.rest.url") + "/api/now/table/sys_scope?" + query
 
 	log.WithFields(log.Fields{"endpoint": endpoint}).Debug("Requesting scope data")
 
-	response, err := RequestScopeData(endpoint)
+	response, err := RequestScopeData(ctx, endpoint)
 
 	if err != nil {
 		return "", err
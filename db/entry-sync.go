@@ -0,0 +1,84 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+	"time"
+)
+
+// the watermark is the highest sys_updated_on value of the last successful
+// sync of a table, kept per query (for scope pulls the query contains the scope)
+func QuerySyncWatermark(tableName string, query string) (bool, string) {
+	dbc := conf.GetDB()
+	stmt, err := dbc.Prepare("SELECT s.sys_updated_on FROM entry_sync s LEFT JOIN entry_table t ON s.entry_table=t.id WHERE t.name=? AND s.query=? LIMIT 1")
+
+	if err != nil {
+		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
+		return false, ""
+	}
+
+	defer stmt.Close()
+
+	sysUpdatedOn := ""
+	err = stmt.QueryRow(tableName, query).Scan(&sysUpdatedOn)
+
+	if err != nil {
+		log.WithFields(log.Fields{"warn": err}).Debug("The sync watermark was not found in the database!")
+		if err == sql.ErrNoRows {
+			// no rows found, it does not exist
+			return false, ""
+		} else {
+			conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
+			return false, ""
+		}
+	}
+
+	return true, sysUpdatedOn
+}
+
+func WriteSyncWatermark(tableName string, query string, sysUpdatedOn string) error {
+	dbc := conf.GetDB()
+
+	success, tableID := QueryTable(tableName)
+
+	if !success {
+		err := errors.New("table_not_found")
+		log.WithFields(log.Fields{"warn": err}).Debug("Table not found! Please re-download!")
+		return err
+	}
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	result, err := dbc.Exec("UPDATE entry_sync SET sys_updated_on=?, last_modified=? WHERE entry_table=? AND query=?", sysUpdatedOn, time.Now().UnixNano(), tableID, query)
+
+	if err != nil {
+		conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	// insert the watermark on the first sync
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		return nil
+	}
+
+	stmt, err := dbc.Prepare("INSERT INTO entry_sync(entry_table, query, sys_updated_on, last_modified) VALUES(?,?,?,?)")
+
+	if err != nil {
+		conf.Err("There was an error while preparing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(tableID, query, sysUpdatedOn, time.Now().UnixNano())
+
+	if err != nil {
+		conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	return nil
+}
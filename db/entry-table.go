@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -10,7 +11,7 @@ import (
 	"github.com/sn-edit/sn-edit/conf"
 )
 
-func WriteTable(tableName string) error {
+func WriteTable(ctx context.Context, tableName string) error {
 	config := conf.GetConfig()
 	dbc := conf.GetDB()
 
@@ -25,7 +26,7 @@ func WriteTable(tableName string) error {
 	// https://devxxxx.service-now.com/api/now/table/sys_db_object?sysparm_query=name=sys_db_object&sysparm_fields=sys_id,sys_scope,name&sysparm_limit=1
 	tableAPIURL := config.GetString("app.core.rest.url") + "/api/now/table/sys_db_object?sysparm_query=name=" + tableName + "&sysparm_fields=sys_id,sys_scope.sys_id,sys_scope.name,name&sysparm_limit=1"
 
-	response, err := api.Get(tableAPIURL)
+	response, err := api.Get(ctx, tableAPIURL)
 
 	if err != nil {
 		return err
@@ -101,14 +102,24 @@ func WriteTable(tableName string) error {
 		return err
 	}
 
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	// the table could have been written in the meantime by a parallel download
+	if exists, _ := TableExists(tableName); exists == true {
+		log.WithFields(log.Fields{"error": "table_exists"}).Debug("Table already exists, no insert!")
+		return nil
+	}
+
 	stmt, err := dbc.Prepare("INSERT INTO entry_table (sys_id, name, sys_scope) VALUES(?,?,?)")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("Error while preparing the query!", log.Fields{"error": err}, false)
 		return err
 	}
 
+	defer stmt.Close()
+
 	_, err = stmt.Exec(resultTableSysID, resultTableName, scopeID)
 
 	if err != nil {
@@ -122,13 +133,14 @@ func WriteTable(tableName string) error {
 func QueryTable(tableName string) (bool, string) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT id FROM entry_table WHERE name=? LIMIT 1")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("Error while querying database data!", log.Fields{"error": err}, false)
 		return false, ""
 	}
 
+	defer stmt.Close()
+
 	id := ""
 	err = stmt.QueryRow(tableName).Scan(&id)
 
@@ -149,13 +161,14 @@ func QueryTable(tableName string) (bool, string) {
 func TableExists(tableName string) (bool, string) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT id FROM entry_table WHERE name=? LIMIT 1")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("Error while querying database data!", log.Fields{"error": err}, false)
 		return false, ""
 	}
 
+	defer stmt.Close()
+
 	sysID := ""
 	err = stmt.QueryRow(tableName).Scan(&sysID)
 
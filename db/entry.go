@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	log "github.com/sirupsen/logrus"
@@ -10,11 +11,11 @@ import (
 )
 
 // provides methods to handle entries
-func WriteEntry(tableName string, uniqueKeyName string, sysID string, sysScopeSysID string) error {
+func WriteEntry(ctx context.Context, tableName string, uniqueKeyName string, sysID string, sysScopeSysID string) error {
 	dbc := conf.GetDB()
 	// get table id from name if found
 	// write table data
-	err := WriteTable(tableName)
+	err := WriteTable(ctx, tableName)
 
 	if err != nil {
 		log.WithFields(log.Fields{"warn": "table_write_error"}).Debug("Table already exists, no insert!")
@@ -28,15 +29,17 @@ func WriteEntry(tableName string, uniqueKeyName string, sysID string, sysScopeSy
 		return err
 	}
 
-	// write scope for file
-	sysScope, err := RequestScopeDataFromInstance(sysScopeSysID)
+	// write scope for file, only request it if not known yet
+	if found, _ := QueryScope(sysScopeSysID); !found {
+		_, err = RequestScopeDataFromInstance(ctx, sysScopeSysID)
 
-	if err != nil {
-		return err
+		if err != nil {
+			return err
+		}
 	}
 
 	// get scope for file
-	found, fileScope := QueryScope(sysScope)
+	found, fileScope := QueryScope(sysScopeSysID)
 
 	if !found {
 		err = errors.New("entry_not_found")
@@ -44,23 +47,35 @@ func WriteEntry(tableName string, uniqueKeyName string, sysID string, sysScopeSy
 		return err
 	}
 
-	// check if entry exists
-	if exists := EntryExists(tableID, sysID, fileScope); exists == true {
-		log.WithFields(log.Fields{"warn": "entry_write_error"}).Debug("Entry already exists, no insert!")
-		return nil
-	}
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
 
 	// filter name before entry to the db
 	uniqueKeyName = file.FilterSpecialChars(uniqueKeyName)
 
+	// the entry may have been renamed or moved to another scope since the last download
+	if exists := EntryExists(tableID, sysID); exists == true {
+		log.WithFields(log.Fields{"sys_id": sysID, "table": tableName}).Debug("Entry already exists, updating it!")
+
+		_, err = dbc.Exec("UPDATE entry SET unique_key=?, sys_scope=?, last_modified=? WHERE sys_id=? AND entry_table=?", uniqueKeyName, fileScope, time.Now().UnixNano(), sysID, tableID)
+
+		if err != nil {
+			conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+			return err
+		}
+
+		return nil
+	}
+
 	stmt, err := dbc.Prepare("INSERT INTO entry(sys_id, unique_key, entry_table, sys_scope, last_modified) VALUES(?,?,?,?,?)")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("There was an error while preparing the query!", log.Fields{"error": err}, false)
 		return err
 	}
 
+	defer stmt.Close()
+
 	_, err = stmt.Exec(sysID, uniqueKeyName, tableID, fileScope, time.Now().UnixNano())
 
 	if err != nil {
@@ -74,13 +89,14 @@ func WriteEntry(tableName string, uniqueKeyName string, sysID string, sysScopeSy
 func QueryUniqueKey(tableName string, sysID string) (bool, string) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT unique_key FROM entry e LEFT JOIN entry_table t ON e.entry_table=t.id WHERE e.sys_id=? AND t.name=? LIMIT 1")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
 		return false, ""
 	}
 
+	defer stmt.Close()
+
 	uniqueKey := ""
 	err = stmt.QueryRow(sysID, tableName).Scan(&uniqueKey)
 
@@ -101,13 +117,14 @@ func QueryUniqueKey(tableName string, sysID string) (bool, string) {
 func GetEntryScopeName(tableName string, sysID string) (bool, string) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT s.name FROM entry e LEFT JOIN entry_scope s ON e.sys_scope=s.id LEFT JOIN entry_table t ON e.entry_table=t.id WHERE e.sys_id=? AND t.name=? LIMIT 1;")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
 		return false, ""
 	}
 
+	defer stmt.Close()
+
 	scopeName := ""
 	err = stmt.QueryRow(sysID, tableName).Scan(&scopeName)
 
@@ -125,19 +142,20 @@ func GetEntryScopeName(tableName string, sysID string) (bool, string) {
 	return true, scopeName
 }
 
-// todo: Implement update of existing entry with the updated fields
-func EntryExists(tableID string, sysID string, sysScope int64) bool {
+// the scope is not part of the check, an entry keeps its sys_id when moved to another scope
+func EntryExists(tableID string, sysID string) bool {
 	dbc := conf.GetDB()
-	stmt, err := dbc.Prepare("SELECT unique_key FROM entry WHERE sys_id=? AND entry_table=? AND sys_scope=? LIMIT 1")
-	defer stmt.Close()
+	stmt, err := dbc.Prepare("SELECT unique_key FROM entry WHERE sys_id=? AND entry_table=? LIMIT 1")
 
 	if err != nil {
 		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
 		return false
 	}
 
+	defer stmt.Close()
+
 	id := ""
-	err = stmt.QueryRow(sysID, tableID, sysScope).Scan(&id)
+	err = stmt.QueryRow(sysID, tableID).Scan(&id)
 
 	if err != nil {
 		log.WithFields(log.Fields{"warn": err}).Debug("The script was not found in the database!")
@@ -152,3 +170,115 @@ func EntryExists(tableID string, sysID string, sysScope int64) bool {
 
 	return true
 }
+
+// Entry is a downloaded record as stored in the database
+type Entry struct {
+	ID           int64
+	SysID        string
+	TableName    string
+	ScopeName    string
+	UniqueKey    string
+	SysUpdatedOn string
+	SysModCount  int64
+}
+
+const entrySelect = "SELECT e.id, e.sys_id, t.name, s.name, e.unique_key, IFNULL(e.sys_updated_on, ''), IFNULL(e.sys_mod_count, 0) FROM entry e LEFT JOIN entry_table t ON e.entry_table=t.id LEFT JOIN entry_scope s ON e.sys_scope=s.id"
+
+func QueryEntry(tableName string, sysID string) (bool, Entry) {
+	dbc := conf.GetDB()
+	stmt, err := dbc.Prepare(entrySelect + " WHERE e.sys_id=? AND t.name=? LIMIT 1")
+
+	if err != nil {
+		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
+		return false, Entry{}
+	}
+
+	defer stmt.Close()
+
+	entry := Entry{}
+	err = stmt.QueryRow(sysID, tableName).Scan(&entry.ID, &entry.SysID, &entry.TableName, &entry.ScopeName, &entry.UniqueKey, &entry.SysUpdatedOn, &entry.SysModCount)
+
+	if err != nil {
+		log.WithFields(log.Fields{"warn": err}).Debug("The entry was not found in the database!")
+		if err == sql.ErrNoRows {
+			// no rows found, it does not exist
+			return false, Entry{}
+		} else {
+			conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
+			return false, Entry{}
+		}
+	}
+
+	return true, entry
+}
+
+func ListEntries() ([]Entry, error) {
+	dbc := conf.GetDB()
+
+	rows, err := dbc.Query(entrySelect + " ORDER BY t.name, e.unique_key")
+
+	if err != nil {
+		conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []Entry
+
+	for rows.Next() {
+		entry := Entry{}
+		err := rows.Scan(&entry.ID, &entry.SysID, &entry.TableName, &entry.ScopeName, &entry.UniqueKey, &entry.SysUpdatedOn, &entry.SysModCount)
+
+		if err != nil {
+			conf.Err("Error while iterating through the results!", log.Fields{"error": err}, false)
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// stores the sys_updated_on and sys_mod_count of the entry as seen on the instance
+func WriteEntryRemote(tableName string, sysID string, sysUpdatedOn string, sysModCount int64) error {
+	dbc := conf.GetDB()
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	_, err := dbc.Exec("UPDATE entry SET sys_updated_on=?, sys_mod_count=? WHERE sys_id=? AND entry_table=(SELECT id FROM entry_table WHERE name=?)", sysUpdatedOn, sysModCount, sysID, tableName)
+
+	if err != nil {
+		conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	return nil
+}
+
+// removes the entry and the state of its fields, used after the entry was deleted on the instance
+func DeleteEntry(entryID int64) error {
+	dbc := conf.GetDB()
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	tx, err := dbc.Begin()
+
+	if err != nil {
+		conf.Err("There was an error while starting the transaction!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	for _, query := range []string{"DELETE FROM entry_field WHERE entry=?", "DELETE FROM entry WHERE id=?"} {
+		if _, err = tx.Exec(query, entryID); err != nil {
+			tx.Rollback()
+			conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
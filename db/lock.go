@@ -0,0 +1,7 @@
+package db
+
+import "sync"
+
+// guards the check and insert sequences against parallel bulk operations,
+// otherwise the same scope, table or entry could be inserted twice
+var writeMutex sync.Mutex
@@ -0,0 +1,63 @@
+// Package tokencache keeps the OAuth tokens of the instance between the runs, the tokens are
+// encrypted by the api package before they are written
+package tokencache
+
+import (
+	"database/sql"
+	log "github.com/sirupsen/logrus"
+	"github.com/sn-edit/sn-edit/conf"
+)
+
+// Token is a token received from the instance
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	// unix time the access token expires at
+	ExpiresAt int64
+}
+
+// QueryToken returns the cached (encrypted) token of the client, the client identifies the token endpoint, the OAuth client and the user
+func QueryToken(client string) (bool, Token) {
+	dbc := conf.GetDB()
+	token := Token{}
+
+	err := dbc.QueryRow("SELECT IFNULL(access_token, ''), IFNULL(refresh_token, ''), IFNULL(expires_at, 0) FROM oauth_token WHERE client=? LIMIT 1", client).Scan(&token.AccessToken, &token.RefreshToken, &token.ExpiresAt)
+
+	if err != nil {
+		log.WithFields(log.Fields{"warn": err}).Debug("The OAuth token was not found in the database!")
+		if err != sql.ErrNoRows {
+			conf.Err("There was an error while querying the database!", log.Fields{"error": err}, false)
+		}
+
+		return false, Token{}
+	}
+
+	return true, token
+}
+
+// WriteToken caches the (encrypted) token of the client, replacing the previous one, the token source
+// serialises the writes
+func WriteToken(client string, token Token) error {
+	dbc := conf.GetDB()
+
+	result, err := dbc.Exec("UPDATE oauth_token SET access_token=?, refresh_token=?, expires_at=? WHERE client=?", token.AccessToken, token.RefreshToken, token.ExpiresAt, client)
+
+	if err != nil {
+		conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	// insert the token of the first login
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		return nil
+	}
+
+	_, err = dbc.Exec("INSERT INTO oauth_token(client, access_token, refresh_token, expires_at) VALUES(?,?,?,?)", client, token.AccessToken, token.RefreshToken, token.ExpiresAt)
+
+	if err != nil {
+		conf.Err("There was an error while executing the query!", log.Fields{"error": err}, false)
+		return err
+	}
+
+	return nil
+}
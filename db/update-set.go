@@ -8,6 +8,10 @@ import (
 
 func WriteUpdateSet(updateSetName string, updateSetSysID string, updateSetScope int64, current bool) error {
 	dbc := conf.GetDB()
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
 	// check if entry exists
 	if exists, _ := UpdateSetExists(updateSetSysID); exists == true {
 		log.WithFields(log.Fields{"error": "scope_exists"}).Debug("Update set already exists, no insert!")
@@ -15,13 +19,14 @@ func WriteUpdateSet(updateSetName string, updateSetSysID string, updateSetScope
 	}
 
 	stmt, err := dbc.Prepare("INSERT INTO update_set(sys_id, name, sys_scope, current) VALUES(?,?,?,?)")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("Error while preparing the query!", log.Fields{"error": err}, false)
 		return err
 	}
 
+	defer stmt.Close()
+
 	_, err = stmt.Exec(updateSetSysID, updateSetName, updateSetScope, current)
 
 	if err != nil {
@@ -35,13 +40,14 @@ func WriteUpdateSet(updateSetName string, updateSetSysID string, updateSetScope
 func QueryUpdateSet(updateSetSysID string) (bool, string, string) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT sys_id,name FROM update_set WHERE sys_id=? LIMIT 1")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("Error while querying database data!", log.Fields{"error": err}, false)
 		return false, "", ""
 	}
 
+	defer stmt.Close()
+
 	sysID := ""
 	name := ""
 	err = stmt.QueryRow(updateSetSysID).Scan(&sysID, &name)
@@ -96,13 +102,14 @@ func ListUpdateSets(scopeID int64) ([]map[string]interface{}, error) {
 func UpdateSetExists(updateSetSysID string) (bool, string) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT id FROM update_set WHERE sys_id=? LIMIT 1")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("Error while querying database data!", log.Fields{"error": err}, false)
 		return false, ""
 	}
 
+	defer stmt.Close()
+
 	id := ""
 	err = stmt.QueryRow(updateSetSysID).Scan(&id)
 
@@ -123,13 +130,14 @@ func UpdateSetExists(updateSetSysID string) (bool, string) {
 func UpdateSetsLoaded(scopeID int64) (bool, error) {
 	dbc := conf.GetDB()
 	stmt, err := dbc.Prepare("SELECT id FROM update_set WHERE sys_scope=? LIMIT 1")
-	defer stmt.Close()
 
 	if err != nil {
 		conf.Err("Error while querying database data!", log.Fields{"error": err}, false)
 		return false, err
 	}
 
+	defer stmt.Close()
+
 	id := ""
 	err = stmt.QueryRow(scopeID).Scan(&id)
 
@@ -146,3 +154,34 @@ func UpdateSetsLoaded(scopeID int64) (bool, error) {
 
 	return true, nil
 }
+
+// QueryCurrentUpdateSet returns the update set marked as current for the scope,
+// the update sets of a scope are loaded with the updateset --list command
+func QueryCurrentUpdateSet(scopeName string) (bool, string, string) {
+	dbc := conf.GetDB()
+	stmt, err := dbc.Prepare("SELECT u.sys_id, u.name FROM update_set u LEFT JOIN entry_scope s ON u.sys_scope=s.id WHERE s.name=? AND u.current=1 LIMIT 1")
+
+	if err != nil {
+		conf.Err("Error while querying database data!", log.Fields{"error": err}, false)
+		return false, "", ""
+	}
+
+	defer stmt.Close()
+
+	sysID := ""
+	name := ""
+	err = stmt.QueryRow(scopeName).Scan(&sysID, &name)
+
+	if err != nil {
+		log.WithFields(log.Fields{"warn": err}).Debug("The current update set was not found in the database!")
+		if err == sql.ErrNoRows {
+			// no rows found, it does not exist
+			return false, "", ""
+		} else {
+			conf.Err("Error while querying database data!", log.Fields{"error": err}, false)
+			return false, "", ""
+		}
+	}
+
+	return true, sysID, name
+}
@@ -0,0 +1,506 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	Equal  = ' '
+	Delete = '-'
+	Insert = '+'
+)
+
+// Edit is one line of the edit script turning the old lines into the new ones,
+// OldIndex and NewIndex are the positions of the line (-1 if not present on that side)
+type Edit struct {
+	Kind     byte
+	OldIndex int
+	NewIndex int
+	Text     string
+}
+
+// Hunk is a block of changes with the surrounding context, as in a unified diff.
+// The lines are prefixed with the kind of the edit and do not contain the line break.
+type Hunk struct {
+	OldStart int      `json:"old_start"`
+	OldLines int      `json:"old_lines"`
+	NewStart int      `json:"new_start"`
+	NewLines int      `json:"new_lines"`
+	Lines    []string `json:"lines"`
+}
+
+// SplitLines splits the text into lines, keeping the line breaks,
+// so a missing line break at the end of the text is detected as a change
+func SplitLines(text string) []string {
+	if len(text) == 0 {
+		return []string{}
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// Edits returns the shortest edit script between the old and new lines (Myers' algorithm)
+func Edits(a []string, b []string) []Edit {
+	// the common prefix and suffix do not need to be searched
+	prefix := 0
+
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := []Edit{}
+
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, Edit{Kind: Equal, OldIndex: i, NewIndex: i, Text: a[i]})
+	}
+
+	for _, edit := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		if edit.OldIndex >= 0 {
+			edit.OldIndex += prefix
+		}
+
+		if edit.NewIndex >= 0 {
+			edit.NewIndex += prefix
+		}
+
+		edits = append(edits, edit)
+	}
+
+	for i := suffix; i > 0; i-- {
+		edits = append(edits, Edit{Kind: Equal, OldIndex: len(a) - i, NewIndex: len(b) - i, Text: a[len(a)-i]})
+	}
+
+	return edits
+}
+
+func myers(a []string, b []string) []Edit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	// the furthest reaching paths of every step, only the diagonals -d..d are kept
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk back from the end to collect the edits in reverse
+	var reversed []Edit
+	x, y := n, m
+
+	for d := len(trace) - 1; d > 0; d-- {
+		snapshot := trace[d]
+		k := x - y
+
+		var prevK int
+
+		if k == -d || (k != d && snapshot[k-1+d] < snapshot[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := snapshot[prevK+d]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, Edit{Kind: Equal, OldIndex: x, NewIndex: y, Text: a[x]})
+		}
+
+		if x == prevX {
+			y--
+			reversed = append(reversed, Edit{Kind: Insert, OldIndex: -1, NewIndex: y, Text: b[y]})
+		} else {
+			x--
+			reversed = append(reversed, Edit{Kind: Delete, OldIndex: x, NewIndex: -1, Text: a[x]})
+		}
+	}
+
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, Edit{Kind: Equal, OldIndex: x, NewIndex: y, Text: a[x]})
+	}
+
+	edits := make([]Edit, 0, len(reversed))
+
+	for i := len(reversed) - 1; i >= 0; i-- {
+		edits = append(edits, reversed[i])
+	}
+
+	return edits
+}
+
+// Hunks groups the changes between the old and new lines with the given number of context lines
+func Hunks(a []string, b []string, context int) []Hunk {
+	edits := Edits(a, b)
+	hunks := []Hunk{}
+
+	for i := 0; i < len(edits); {
+		if edits[i].Kind == Equal {
+			i++
+			continue
+		}
+
+		// include the context before the change
+		start := i - context
+
+		if start < 0 {
+			start = 0
+		}
+
+		// extend the hunk as long as the next change is within the context
+		end := i
+
+		for end < len(edits) {
+			if edits[end].Kind != Equal {
+				end++
+				continue
+			}
+
+			next := end
+
+			for next < len(edits) && edits[next].Kind == Equal {
+				next++
+			}
+
+			if next == len(edits) || next-end > 2*context {
+				end += context
+
+				if end > len(edits) {
+					end = len(edits)
+				}
+
+				break
+			}
+
+			end = next
+		}
+
+		hunks = append(hunks, newHunk(edits[start:end], oldPosition(edits, start), newPosition(edits, start)))
+		i = end
+	}
+
+	return hunks
+}
+
+// the number of old lines before the edit at the index
+func oldPosition(edits []Edit, index int) int {
+	position := 0
+
+	for _, edit := range edits[:index] {
+		if edit.Kind != Insert {
+			position++
+		}
+	}
+
+	return position
+}
+
+// the number of new lines before the edit at the index
+func newPosition(edits []Edit, index int) int {
+	position := 0
+
+	for _, edit := range edits[:index] {
+		if edit.Kind != Delete {
+			position++
+		}
+	}
+
+	return position
+}
+
+func newHunk(edits []Edit, oldBefore int, newBefore int) Hunk {
+	hunk := Hunk{Lines: []string{}}
+
+	for _, edit := range edits {
+		if edit.Kind != Insert {
+			hunk.OldLines++
+		}
+
+		if edit.Kind != Delete {
+			hunk.NewLines++
+		}
+
+		hunk.Lines = append(hunk.Lines, string(edit.Kind)+edit.Text)
+	}
+
+	// an empty range starts at the line before, like in the unified format
+	hunk.OldStart = oldBefore
+
+	if hunk.OldLines > 0 {
+		hunk.OldStart++
+	}
+
+	hunk.NewStart = newBefore
+
+	if hunk.NewLines > 0 {
+		hunk.NewStart++
+	}
+
+	for i, line := range hunk.Lines {
+		hunk.Lines[i] = strings.TrimSuffix(line, "\n")
+	}
+
+	return hunk
+}
+
+// Unified renders the hunks in the unified diff format
+func Unified(oldName string, newName string, a []string, b []string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+
+	for _, hunk := range hunks {
+		builder.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines))
+
+		oldLine := hunk.OldStart
+		newLine := hunk.NewStart
+
+		if hunk.OldLines == 0 {
+			oldLine++
+		}
+
+		if hunk.NewLines == 0 {
+			newLine++
+		}
+
+		for _, line := range hunk.Lines {
+			builder.WriteString(line + "\n")
+
+			// mark the lines of the last line without a line break
+			missingBreak := false
+
+			switch line[0] {
+			case Equal:
+				missingBreak = oldLine == len(a) && !strings.HasSuffix(a[oldLine-1], "\n")
+				oldLine++
+				newLine++
+			case Delete:
+				missingBreak = oldLine == len(a) && !strings.HasSuffix(a[oldLine-1], "\n")
+				oldLine++
+			case Insert:
+				missingBreak = newLine == len(b) && !strings.HasSuffix(b[newLine-1], "\n")
+				newLine++
+			}
+
+			if missingBreak {
+				builder.WriteString("\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+// change is a replacement of the base lines start..end (exclusive) by the lines of one side
+type change struct {
+	start int
+	end   int
+	lines []string
+}
+
+// changes collects the edits between the base and one side into replacements of base lines
+func changes(base []string, side []string) []change {
+	var result []change
+	var current *change
+	position := 0
+
+	for _, edit := range Edits(base, side) {
+		if edit.Kind == Equal {
+			if current != nil {
+				result = append(result, *current)
+				current = nil
+			}
+
+			position++
+			continue
+		}
+
+		if current == nil {
+			current = &change{start: position, end: position}
+		}
+
+		if edit.Kind == Delete {
+			position++
+			current.end = position
+		} else {
+			current.lines = append(current.lines, edit.Text)
+		}
+	}
+
+	if current != nil {
+		result = append(result, *current)
+	}
+
+	return result
+}
+
+// apply replaces the base lines start..end with the given changes of one side
+func apply(base []string, start int, end int, sideChanges []change) []string {
+	var result []string
+	position := start
+
+	for _, c := range sideChanges {
+		result = append(result, base[position:c.start]...)
+		result = append(result, c.lines...)
+		position = c.end
+	}
+
+	return append(result, base[position:end]...)
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// terminated makes sure the last line has a line break, so the conflict markers start on their own line
+func terminated(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+
+	result := append([]string{}, lines[:len(lines)-1]...)
+
+	return append(result, lines[len(lines)-1]+"\n")
+}
+
+// Merge combines the changes of the local and remote lines made on top of the common base lines.
+// Changes of both sides touching the same base lines are written between conflict markers,
+// unless both sides made the same change. It returns the merged lines and if there were conflicts.
+func Merge(base []string, local []string, remote []string, localName string, remoteName string) ([]string, bool) {
+	localChanges := changes(base, local)
+	remoteChanges := changes(base, remote)
+
+	var result []string
+	conflict := false
+	position := 0
+	l, r := 0, 0
+
+	for l < len(localChanges) || r < len(remoteChanges) {
+		// start the region with the change coming first in the base
+		var regionStart, regionEnd int
+
+		if r >= len(remoteChanges) || (l < len(localChanges) && localChanges[l].start <= remoteChanges[r].start) {
+			regionStart, regionEnd = localChanges[l].start, localChanges[l].end
+		} else {
+			regionStart, regionEnd = remoteChanges[r].start, remoteChanges[r].end
+		}
+
+		// grow the region as long as changes of either side touch it
+		localFrom, remoteFrom := l, r
+
+		for {
+			if l < len(localChanges) && localChanges[l].start <= regionEnd {
+				if localChanges[l].end > regionEnd {
+					regionEnd = localChanges[l].end
+				}
+
+				l++
+				continue
+			}
+
+			if r < len(remoteChanges) && remoteChanges[r].start <= regionEnd {
+				if remoteChanges[r].end > regionEnd {
+					regionEnd = remoteChanges[r].end
+				}
+
+				r++
+				continue
+			}
+
+			break
+		}
+
+		result = append(result, base[position:regionStart]...)
+		position = regionEnd
+
+		localRegion := apply(base, regionStart, regionEnd, localChanges[localFrom:l])
+		remoteRegion := apply(base, regionStart, regionEnd, remoteChanges[remoteFrom:r])
+
+		switch {
+		case localFrom == l:
+			result = append(result, remoteRegion...)
+		case remoteFrom == r, equalLines(localRegion, remoteRegion):
+			result = append(result, localRegion...)
+		default:
+			conflict = true
+			result = append(result, "<<<<<<< "+localName+"\n")
+			result = append(result, terminated(localRegion)...)
+			result = append(result, "||||||| base\n")
+			result = append(result, terminated(base[regionStart:regionEnd])...)
+			result = append(result, "=======\n")
+			result = append(result, terminated(remoteRegion)...)
+			result = append(result, ">>>>>>> "+remoteName+"\n")
+		}
+	}
+
+	return append(result, base[position:]...), conflict
+}
+
+// HasConflictMarkers reports if the text still contains the markers written by Merge
+func HasConflictMarkers(text string) bool {
+	for _, line := range SplitLines(text) {
+		if strings.HasPrefix(line, "<<<<<<< ") || strings.HasPrefix(line, ">>>>>>> ") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", []string{}},
+		{"terminated", "a\nb\n", []string{"a\n", "b\n"}},
+		{"missing line break", "a\nb", []string{"a\n", "b"}},
+		{"crlf", "a\r\nb\r\n", []string{"a\r\n", "b\r\n"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SplitLines(test.text); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("SplitLines(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEdits(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       string
+		b       string
+		changes int
+	}{
+		{"both empty", "", "", 0},
+		{"identical", "a\nb\nc\n", "a\nb\nc\n", 0},
+		{"insert into empty", "", "a\nb\n", 2},
+		{"delete everything", "a\nb\n", "", 2},
+		{"insert in the middle", "a\nc\n", "a\nb\nc\n", 1},
+		{"delete in the middle", "a\nb\nc\n", "a\nc\n", 1},
+		{"replace a line", "a\nb\nc\n", "a\nx\nc\n", 2},
+		{"missing final line break", "a\nb\n", "a\nb", 2},
+		{"move a line", "a\nb\nc\nd\n", "b\nc\nd\na\n", 2},
+		{"interleaved", "a\nb\nc\nd\ne\n", "a\nx\nc\ny\ne\n", 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := SplitLines(test.a), SplitLines(test.b)
+			edits := Edits(a, b)
+
+			oldLines, newLines, changes := []string{}, []string{}, 0
+
+			for _, edit := range edits {
+				switch edit.Kind {
+				case Equal:
+					if a[edit.OldIndex] != edit.Text || b[edit.NewIndex] != edit.Text {
+						t.Fatalf("equal edit %+v does not match the lines", edit)
+					}
+
+					oldLines = append(oldLines, edit.Text)
+					newLines = append(newLines, edit.Text)
+				case Delete:
+					if a[edit.OldIndex] != edit.Text || edit.NewIndex != -1 {
+						t.Fatalf("delete edit %+v does not match the old lines", edit)
+					}
+
+					oldLines = append(oldLines, edit.Text)
+					changes++
+				case Insert:
+					if b[edit.NewIndex] != edit.Text || edit.OldIndex != -1 {
+						t.Fatalf("insert edit %+v does not match the new lines", edit)
+					}
+
+					newLines = append(newLines, edit.Text)
+					changes++
+				default:
+					t.Fatalf("unknown edit kind %q", edit.Kind)
+				}
+			}
+
+			if !reflect.DeepEqual(oldLines, a) || !reflect.DeepEqual(newLines, b) {
+				t.Errorf("the edits do not reproduce the lines: old %q, new %q", oldLines, newLines)
+			}
+
+			if changes != test.changes {
+				t.Errorf("got %d changed lines, want %d (the shortest edit script)", changes, test.changes)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		local    string
+		remote   string
+		want     string
+		conflict bool
+	}{
+		{
+			name:   "no changes",
+			base:   "a\nb\nc\n",
+			local:  "a\nb\nc\n",
+			remote: "a\nb\nc\n",
+			want:   "a\nb\nc\n",
+		},
+		{
+			name:   "only local changes",
+			base:   "a\nb\nc\n",
+			local:  "a\nx\nc\n",
+			remote: "a\nb\nc\n",
+			want:   "a\nx\nc\n",
+		},
+		{
+			name:   "only remote changes",
+			base:   "a\nb\nc\n",
+			local:  "a\nb\nc\n",
+			remote: "a\nb\nc\nd\n",
+			want:   "a\nb\nc\nd\n",
+		},
+		{
+			name:   "changes of different lines",
+			base:   "a\nb\nc\nd\ne\n",
+			local:  "x\nb\nc\nd\ne\n",
+			remote: "a\nb\nc\nd\ny\n",
+			want:   "x\nb\nc\nd\ny\n",
+		},
+		{
+			name:   "identical changes",
+			base:   "a\nb\nc\n",
+			local:  "a\nx\nc\n",
+			remote: "a\nx\nc\n",
+			want:   "a\nx\nc\n",
+		},
+		{
+			name:   "identical deletions",
+			base:   "a\nb\nc\n",
+			local:  "a\nc\n",
+			remote: "a\nc\n",
+			want:   "a\nc\n",
+		},
+		{
+			name:     "conflicting changes",
+			base:     "a\nb\nc\n",
+			local:    "a\nx\nc\n",
+			remote:   "a\ny\nc\n",
+			want:     "a\n<<<<<<< local\nx\n||||||| base\nb\n=======\ny\n>>>>>>> remote\nc\n",
+			conflict: true,
+		},
+		{
+			name:     "change against deletion",
+			base:     "a\nb\nc\n",
+			local:    "a\nx\nc\n",
+			remote:   "a\nc\n",
+			want:     "a\n<<<<<<< local\nx\n||||||| base\nb\n=======\n>>>>>>> remote\nc\n",
+			conflict: true,
+		},
+		{
+			name:     "conflict without final line breaks",
+			base:     "a",
+			local:    "x",
+			remote:   "y",
+			want:     "<<<<<<< local\nx\n||||||| base\na\n=======\ny\n>>>>>>> remote\n",
+			conflict: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, conflict := Merge(SplitLines(test.base), SplitLines(test.local), SplitLines(test.remote), "local", "remote")
+
+			if got := strings.Join(merged, ""); got != test.want {
+				t.Errorf("Merge() = %q, want %q", got, test.want)
+			}
+
+			if conflict != test.conflict {
+				t.Errorf("Merge() conflict = %v, want %v", conflict, test.conflict)
+			}
+
+			if HasConflictMarkers(strings.Join(merged, "")) != test.conflict {
+				t.Errorf("HasConflictMarkers() does not match the conflict of the merge")
+			}
+		})
+	}
+}
+
+func TestHasConflictMarkers(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"empty", "", false},
+		{"plain script", "var a = 1;\n", false},
+		{"start marker", "a\n<<<<<<< local\nb\n", true},
+		{"end marker", "a\n>>>>>>> remote\n", true},
+		{"marker without name", "<<<<<<<\n", false},
+		{"marker inside a line", "var s = '<<<<<<< local';\n", false},
+		{"separator only", "a\n=======\nb\n", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := HasConflictMarkers(test.text); got != test.want {
+				t.Errorf("HasConflictMarkers(%q) = %v, want %v", test.text, got, test.want)
+			}
+		})
+	}
+}
@@ -1,28 +1,54 @@
 package file
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"github.com/kennygrant/sanitize"
 	log "github.com/sirupsen/logrus"
 	"github.com/sn-edit/sn-edit/conf"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
-// Write The contents of the script to a file
-func WriteFile(tableName string, scopeName string, uniqueKeyName string, fieldName string, extension string, contents []byte) error {
-	filePath := GenerateFilePath(tableName, scopeName, uniqueKeyName, fieldName, extension)
-
+// WriteFile writes the value of a field on the instance to its file, normalised by the files policy
+func WriteFile(filePath string, value []byte) error {
 	// just a debug/warning
 	if exists := Exists(filePath); exists == false {
 		err := errors.New("file_not_found")
 		log.WithFields(log.Fields{"error": err, "filepath": filePath}).Debug("File does not exist yet!")
 	}
 
-	err := ioutil.WriteFile(filePath, contents, 0644)
+	return WriteFileAtomic(filePath, Normalise(value))
+}
+
+// WriteFileAtomic writes the contents into a temporary file next to the file and renames it,
+// an interrupted write does not leave a truncated file behind
+func WriteFileAtomic(filePath string, contents []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
 
 	if err != nil {
-		conf.Err("Error writing the file contents!", log.Fields{"error": err, "filepath": filePath}, false)
+		return err
+	}
+
+	_, err = temp.Write(contents)
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), filePath)
+	}
+
+	if err != nil {
+		_ = os.Remove(temp.Name())
 		return err
 	}
 
@@ -40,6 +66,18 @@ func ReadFile(filename string) ([]byte, error) {
 	return dat, nil
 }
 
+// RestoreFile reads the contents of a field file in the style of the value last downloaded (the base),
+// the counterpart of WriteFile
+func RestoreFile(filePath string, base []byte) ([]byte, error) {
+	contents, err := ReadFile(filePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Restore(contents, base), nil
+}
+
 // Returns error if the file exists, nil if it does not exist
 func Exists(filePath string) bool {
 	info, err := os.Stat(filePath)
@@ -52,8 +90,19 @@ func Exists(filePath string) bool {
 }
 
 func GenerateFilePath(tableName string, scopeName string, uniqueFieldName string, fieldName string, extension string) string {
+	return GenerateDirectoryPath(tableName, scopeName, uniqueFieldName) + string(os.PathSeparator) + fieldName + "." + extension
+}
+
+// the directory of an entry, scope names are in lowercase in the folder structure
+func GenerateDirectoryPath(tableName string, scopeName string, uniqueFieldName string) string {
 	config := conf.GetConfig()
-	return config.GetString("app.core.root_directory") + string(os.PathSeparator) + scopeName + string(os.PathSeparator) + tableName + string(os.PathSeparator) + FilterSpecialChars(uniqueFieldName) + string(os.PathSeparator) + fieldName + "." + extension
+	return config.GetString("app.core.root_directory") + string(os.PathSeparator) + strings.ToLower(scopeName) + string(os.PathSeparator) + tableName + string(os.PathSeparator) + FilterSpecialChars(uniqueFieldName)
+}
+
+// Hash returns the sha256 checksum of the contents, used to detect changes of the files
+func Hash(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
 }
 
 func FilterSpecialChars(name string) string {
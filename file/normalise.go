@@ -0,0 +1,91 @@
+package file
+
+import (
+	"bytes"
+	"github.com/sn-edit/sn-edit/conf"
+)
+
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Normalise converts the value of a field on the instance into the contents of its file, following
+// the policy in app.core.files (line endings, byte order mark and a trailing line break)
+func Normalise(value []byte) []byte {
+	config := conf.GetConfig()
+	contents := value
+
+	if config.GetBool("app.core.files.strip_bom") {
+		contents = bytes.TrimPrefix(contents, bom)
+	}
+
+	lineEnding := []byte("\n")
+
+	// values with mixed line endings are kept, their style could not be restored on upload
+	if !hasMixedLineEndings(contents) {
+		switch config.GetString("app.core.files.line_endings") {
+		case conf.LineEndingsLF:
+			contents = convertLineEndings(contents, lineEnding)
+		case conf.LineEndingsCRLF:
+			lineEnding = []byte("\r\n")
+			contents = convertLineEndings(contents, lineEnding)
+		}
+	}
+
+	if config.GetBool("app.core.files.trailing_newline") && len(contents) > 0 && !bytes.HasSuffix(contents, []byte("\n")) {
+		contents = append(append([]byte{}, contents...), lineEnding...)
+	}
+
+	return contents
+}
+
+// Restore converts the contents of a field file back into the style of the value last downloaded
+// from the instance (the base), so the files which were not changed are uploaded byte-identical
+func Restore(contents []byte, base []byte) []byte {
+	config := conf.GetConfig()
+
+	if config.GetBool("app.core.files.strip_bom") {
+		contents = bytes.TrimPrefix(contents, bom)
+
+		if bytes.HasPrefix(base, bom) {
+			contents = append(append([]byte{}, bom...), contents...)
+		}
+	}
+
+	// the line break added to the file is not part of the value
+	if config.GetBool("app.core.files.trailing_newline") && len(base) > 0 && !bytes.HasSuffix(base, []byte("\n")) {
+		if bytes.HasSuffix(contents, []byte("\r\n")) {
+			contents = contents[:len(contents)-2]
+		} else if bytes.HasSuffix(contents, []byte("\n")) {
+			contents = contents[:len(contents)-1]
+		}
+	}
+
+	if lineEndings := config.GetString("app.core.files.line_endings"); lineEndings == conf.LineEndingsLF || lineEndings == conf.LineEndingsCRLF {
+		switch {
+		case hasMixedLineEndings(base):
+			// kept as they are, like on download
+		case bytes.Contains(base, []byte("\r\n")):
+			contents = convertLineEndings(contents, []byte("\r\n"))
+		default:
+			contents = convertLineEndings(contents, []byte("\n"))
+		}
+	}
+
+	return contents
+}
+
+// convertLineEndings replaces every line ending of the contents with the given one
+func convertLineEndings(contents []byte, lineEnding []byte) []byte {
+	contents = bytes.Replace(contents, []byte("\r\n"), []byte("\n"), -1)
+
+	if bytes.Equal(lineEnding, []byte("\n")) {
+		return contents
+	}
+
+	return bytes.Replace(contents, []byte("\n"), lineEnding, -1)
+}
+
+// hasMixedLineEndings reports if the contents use both windows (CRLF) and unix (LF) line endings
+func hasMixedLineEndings(contents []byte) bool {
+	crlf := bytes.Count(contents, []byte("\r\n"))
+	return crlf > 0 && crlf != bytes.Count(contents, []byte("\n"))
+}
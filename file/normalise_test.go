@@ -0,0 +1,125 @@
+package file
+
+import (
+	"github.com/sn-edit/sn-edit/conf"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setFilesPolicy(lineEndings string, stripBOM bool, trailingNewline bool) {
+	config := viper.New()
+	config.Set("app.core.files.line_endings", lineEndings)
+	config.Set("app.core.files.strip_bom", stripBOM)
+	config.Set("app.core.files.trailing_newline", trailingNewline)
+	conf.SetConfig(config)
+}
+
+func TestNormalise(t *testing.T) {
+	tests := []struct {
+		name            string
+		lineEndings     string
+		stripBOM        bool
+		trailingNewline bool
+		value           string
+		want            string
+	}{
+		{"keep everything", conf.LineEndingsKeep, false, false, "\ufeffa\r\nb", "\ufeffa\r\nb"},
+		{"crlf to lf", conf.LineEndingsLF, false, false, "a\r\nb\r\n", "a\nb\n"},
+		{"lf to crlf", conf.LineEndingsCRLF, false, false, "a\nb\n", "a\r\nb\r\n"},
+		{"mixed line endings are kept", conf.LineEndingsLF, false, false, "a\r\nb\nc", "a\r\nb\nc"},
+		{"strip the bom", conf.LineEndingsKeep, true, false, "\ufeffa\n", "a\n"},
+		{"add the trailing line break", conf.LineEndingsLF, false, true, "a\nb", "a\nb\n"},
+		{"add the trailing crlf", conf.LineEndingsCRLF, false, true, "a\nb", "a\r\nb\r\n"},
+		{"trailing line break present", conf.LineEndingsLF, false, true, "a\n", "a\n"},
+		{"empty value", conf.LineEndingsCRLF, true, true, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setFilesPolicy(test.lineEndings, test.stripBOM, test.trailingNewline)
+
+			if got := string(Normalise([]byte(test.value))); got != test.want {
+				t.Errorf("Normalise(%q) = %q, want %q", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNormaliseRestoreRoundTrip(t *testing.T) {
+	values := []string{
+		"",
+		"a",
+		"a\nb\n",
+		"a\nb",
+		"a\r\nb\r\n",
+		"a\r\nb",
+		"a\r\nb\nc",
+		"a\r\nb\nc\n",
+		"a\nb\r\n",
+		"\n",
+		"\r\n",
+		"a\n\n",
+		"\ufeffa\r\nb",
+		"\ufeffa\nb\n",
+		"\ufeff",
+	}
+
+	for _, lineEndings := range []string{conf.LineEndingsKeep, conf.LineEndingsLF, conf.LineEndingsCRLF} {
+		for _, stripBOM := range []bool{false, true} {
+			for _, trailingNewline := range []bool{false, true} {
+				setFilesPolicy(lineEndings, stripBOM, trailingNewline)
+
+				for _, value := range values {
+					contents := Normalise([]byte(value))
+
+					if got := string(Restore(contents, []byte(value))); got != value {
+						t.Errorf("line_endings=%s strip_bom=%v trailing_newline=%v: Restore(%q) = %q, want %q", lineEndings, stripBOM, trailingNewline, contents, got, value)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRestoreEditedFile(t *testing.T) {
+	setFilesPolicy(conf.LineEndingsLF, true, true)
+
+	// the editor saved the file with lf line endings, the base has a bom, crlf line endings and no final line break
+	base := "\ufeffa\r\nb"
+	edited := "a\nb\nc\n"
+
+	if got := string(Restore([]byte(edited), []byte(base))); got != "\ufeffa\r\nb\r\nc" {
+		t.Errorf("Restore(%q) = %q, want %q", edited, got, "\ufeffa\r\nb\r\nc")
+	}
+}
+
+func TestWriteFileRestoreFile(t *testing.T) {
+	setFilesPolicy(conf.LineEndingsLF, true, true)
+
+	directoryPath, err := ioutil.TempDir("", "sn-edit-file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directoryPath)
+
+	filePath := filepath.Join(directoryPath, "script.js")
+	value := "\ufeffa\r\nb"
+
+	if err := WriteFile(filePath, []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file follows the policy, the value of the instance is restored when it is read
+	if contents, err := ReadFile(filePath); err != nil || string(contents) != "a\nb\n" {
+		t.Errorf("WriteFile(%q) wrote %q, %v, want %q", value, contents, err, "a\nb\n")
+	}
+
+	if restored, err := RestoreFile(filePath, []byte(value)); err != nil || string(restored) != value {
+		t.Errorf("RestoreFile() = %q, %v, want %q", restored, err, value)
+	}
+}
@@ -0,0 +1,86 @@
+package file
+
+import (
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+)
+
+// RecordFileName is the file storing the small fields of an entry of a record table
+const RecordFileName = "record.yaml"
+
+// RecordPath returns the path of the record file in the directory of an entry
+func RecordPath(directoryPath string) string {
+	return filepath.Join(directoryPath, RecordFileName)
+}
+
+// ReadRecord reads the fields of the record file in their order
+func ReadRecord(directoryPath string) (yaml.MapSlice, error) {
+	contents, err := ReadFile(RecordPath(directoryPath))
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := yaml.MapSlice{}
+	err = yaml.Unmarshal(contents, &record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// ReadRecordField returns the value of one field of the record file,
+// a missing field is reported like a missing file
+func ReadRecordField(directoryPath string, fieldName string) (interface{}, error) {
+	record, err := ReadRecord(directoryPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range record {
+		if key, ok := item.Key.(string); ok && key == fieldName {
+			return item.Value, nil
+		}
+	}
+
+	return nil, &os.PathError{Op: "read", Path: RecordPath(directoryPath) + ":" + fieldName, Err: os.ErrNotExist}
+}
+
+// WriteRecordField sets the value of one field in the record file,
+// the other fields and their order are kept
+func WriteRecordField(directoryPath string, fieldName string, value interface{}) error {
+	record, err := ReadRecord(directoryPath)
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		record = yaml.MapSlice{}
+	}
+
+	found := false
+
+	for i, item := range record {
+		if key, ok := item.Key.(string); ok && key == fieldName {
+			record[i].Value = value
+			found = true
+		}
+	}
+
+	if !found {
+		record = append(record, yaml.MapItem{Key: fieldName, Value: value})
+	}
+
+	contents, err := yaml.Marshal(record)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(RecordPath(directoryPath), contents)
+}
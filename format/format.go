@@ -0,0 +1,84 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+)
+
+// the formats of fields which are pretty-printed in the local files
+const (
+	JSON = "json"
+	XML  = "xml"
+)
+
+// Indent pretty-prints the content, ending it with a line break
+func Indent(format string, content []byte) ([]byte, error) {
+	switch format {
+	case JSON:
+		return indentJSON(content)
+	case XML:
+		return indentXML(content)
+	}
+
+	return nil, errors.New("invalid_format")
+}
+
+// Compact removes the whitespace between the values or the indentation between the elements of the content
+func Compact(format string, content []byte) ([]byte, error) {
+	// an empty value saved by an editor
+	if len(bytes.TrimSpace(content)) == 0 {
+		return []byte{}, nil
+	}
+
+	switch format {
+	case JSON:
+		return compactJSON(content)
+	case XML:
+		return compactXML(content)
+	}
+
+	return nil, errors.New("invalid_format")
+}
+
+// Validate reports if the content is not valid in the format, empty content is valid
+func Validate(format string, content []byte) error {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil
+	}
+
+	switch format {
+	case JSON:
+		return validateJSON(content)
+	case XML:
+		return validateXML(content)
+	}
+
+	return errors.New("invalid_format")
+}
+
+// IsCompact reports if the content is valid and does not contain whitespace Compact would remove
+func IsCompact(format string, content []byte) bool {
+	compacted, err := Compact(format, content)
+	return err == nil && bytes.Equal(compacted, content)
+}
+
+// Pretty returns the pretty-printed content if compacting it gives back the content exactly,
+// any other content (like invalid or already indented content) is returned as it is
+func Pretty(format string, content []byte) []byte {
+	if len(content) == 0 || !IsCompact(format, content) {
+		return content
+	}
+
+	indented, err := Indent(format, content)
+
+	if err != nil {
+		return content
+	}
+
+	// the original value could not be restored on upload
+	if compacted, err := Compact(format, indented); err != nil || !bytes.Equal(compacted, content) {
+		return content
+	}
+
+	return indented
+}
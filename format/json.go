@@ -0,0 +1,39 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+func indentJSON(content []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	err := json.Indent(&buffer, content, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	buffer.WriteByte('\n')
+
+	return buffer.Bytes(), nil
+}
+
+func compactJSON(content []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	err := json.Compact(&buffer, content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func validateJSON(content []byte) error {
+	if !json.Valid(content) {
+		return errors.New("invalid_json")
+	}
+
+	return nil
+}
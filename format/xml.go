@@ -0,0 +1,161 @@
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// xmlToken is a token of a document together with its bytes in the document,
+// so everything but the whitespace between the elements is written back unchanged
+type xmlToken struct {
+	Token xml.Token
+	Raw   []byte
+}
+
+// isIndentation reports if the token is whitespace the indentation could have added: a line break
+// followed by the indentation, or any whitespace outside of the root element (at depth 0).
+// Other whitespace between elements (like a space between inline elements of a page) is kept.
+func (t xmlToken) isIndentation(depth int) bool {
+	if _, charData := t.Token.(xml.CharData); !charData || len(bytes.TrimSpace(t.Raw)) > 0 {
+		return false
+	}
+
+	if depth == 0 {
+		return true
+	}
+
+	indentation := bytes.TrimPrefix(bytes.TrimPrefix(t.Raw, []byte("\r")), []byte("\n"))
+
+	return len(indentation) < len(t.Raw) && len(bytes.Trim(indentation, " \t")) == 0
+}
+
+func newXMLDecoder(content []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	// pages and macros use the html entities
+	decoder.Entity = xml.HTMLEntity
+
+	return decoder
+}
+
+func xmlTokens(content []byte) ([]xmlToken, error) {
+	decoder := newXMLDecoder(content)
+	var tokens []xmlToken
+	offset := int64(0)
+
+	for {
+		token, err := decoder.RawToken()
+
+		if err == io.EOF {
+			return tokens, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		end := decoder.InputOffset()
+		tokens = append(tokens, xmlToken{Token: xml.CopyToken(token), Raw: content[offset:end]})
+		offset = end
+	}
+}
+
+func indentXML(content []byte) ([]byte, error) {
+	err := validateXML(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := xmlTokens(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.Buffer{}
+	depth := 0
+	var previous xml.Token
+
+	for _, token := range tokens {
+		if token.isIndentation(depth) {
+			continue
+		}
+
+		if _, end := token.Token.(xml.EndElement); end {
+			depth--
+		}
+
+		_, afterText := previous.(xml.CharData)
+		_, text := token.Token.(xml.CharData)
+		_, afterStart := previous.(xml.StartElement)
+		_, end := token.Token.(xml.EndElement)
+
+		// text and empty elements stay on the line of their element,
+		// a self-closing element is followed by an end element without bytes
+		if previous != nil && !afterText && !text && !(afterStart && end) {
+			buffer.WriteString("\n" + strings.Repeat("  ", depth))
+		}
+
+		buffer.Write(token.Raw)
+
+		if _, start := token.Token.(xml.StartElement); start {
+			depth++
+		}
+
+		previous = token.Token
+	}
+
+	buffer.WriteByte('\n')
+
+	return buffer.Bytes(), nil
+}
+
+func compactXML(content []byte) ([]byte, error) {
+	err := validateXML(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := xmlTokens(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.Buffer{}
+	depth := 0
+
+	for _, token := range tokens {
+		switch token.Token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+
+		if !token.isIndentation(depth) {
+			buffer.Write(token.Raw)
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func validateXML(content []byte) error {
+	decoder := newXMLDecoder(content)
+
+	for {
+		_, err := decoder.Token()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
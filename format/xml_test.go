@@ -0,0 +1,122 @@
+package format
+
+import (
+	"testing"
+)
+
+func TestXMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// the content is expected to be pretty-printed, not kept as it is
+		indented bool
+	}{
+		{"single element", `<a/>`, true},
+		{"nested elements", `<a><b>text</b><c/></a>`, true},
+		{"declaration", `<?xml version="1.0" encoding="UTF-8"?><a><b/></a>`, true},
+		{"attributes", `<a id="1" class='x  y' empty=""><b name="&quot;q&quot;">v</b></a>`, true},
+		{"attribute spacing and line breaks", `<a  id = "1"` + "\n\t" + `b="2"><b/></a>`, true},
+		{"cdata", `<a><script><![CDATA[if (a < b && c > d) { x(); }]]></script></a>`, true},
+		{"cdata with whitespace", `<a><![CDATA[  ` + "\n" + `  ]]><b/></a>`, true},
+		{"comments", `<a><!-- first --><b/><!--second--></a>`, true},
+		{"entities", `<a><b>&lt;tag&gt; &amp; &nbsp;&copy;&#160;&#x263A;</b></a>`, true},
+		{"mixed content", `<p>Hello <b>world</b>, how <i>are</i> you?</p>`, true},
+		{"whitespace between inline elements", `<p><b>a</b> <i>b</i></p>`, true},
+		{"line break between elements", "<a><b/>\n<c/></a>", false},
+		{"jelly page", `<?xml version="1.0" encoding="utf-8" ?><j:jelly trim="false" xmlns:j="jelly:core" xmlns:g="glide"><g:evaluate var="jvar_x">var x = 1 &lt; 2;</g:evaluate><div class="${jvar_x}">$[SP]</div></j:jelly>`, true},
+		{"processing instruction", `<a><?target data?><b/></a>`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := []byte(test.content)
+			pretty := Pretty(XML, content)
+
+			if indented := string(pretty) != test.content; indented != test.indented {
+				t.Fatalf("Pretty() indented = %v, want %v:\n%s", indented, test.indented, pretty)
+			}
+
+			// content which is not compact (like a line break between the elements) is kept as it is
+			if !test.indented {
+				return
+			}
+
+			compacted, err := Compact(XML, pretty)
+
+			if err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+
+			if string(compacted) != test.content {
+				t.Errorf("Compact(Pretty()) = %q, want %q", compacted, test.content)
+			}
+		})
+	}
+}
+
+func TestXMLCompactEditedFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		edited string
+		want   string
+	}{
+		{"indentation", "<p>\n  <b>a</b>\n  <i>b</i>\n</p>\n", `<p><b>a</b><i>b</i></p>`},
+		{"tabs and crlf", "<p>\r\n\t<b>a</b>\r\n\t<i>b</i>\r\n</p>\r\n", `<p><b>a</b><i>b</i></p>`},
+		{"space between inline elements", "<p>\n  <b>a</b> <i>b</i>\n</p>\n", `<p><b>a</b> <i>b</i></p>`},
+		{"spaces before a line break", "<p>\n  <b>a</b>  \n  <i>b</i>\n</p>\n", "<p><b>a</b>  \n  <i>b</i></p>"},
+		{"empty line", "<p>\n  <b>a</b>\n\n  <i>b</i>\n</p>\n", "<p><b>a</b>\n\n  <i>b</i></p>"},
+		{"whitespace around the root element", "\n\n<p>\n  <b>a</b>\n</p>\n\n", `<p><b>a</b></p>`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compacted, err := Compact(XML, []byte(test.edited))
+
+			if err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+
+			if string(compacted) != test.want {
+				t.Errorf("Compact(%q) = %q, want %q", test.edited, compacted, test.want)
+			}
+
+			// the upload is shown pretty-printed again by the next download
+			if pretty, err := Compact(XML, Pretty(XML, compacted)); err != nil || string(pretty) != test.want {
+				t.Errorf("Compact(Pretty(%q)) = %q, %v", compacted, pretty, err)
+			}
+		})
+	}
+}
+
+func TestXMLIndent(t *testing.T) {
+	content := []byte(`<a x="1"><!-- c --><b>text <i>mixed</i></b><c/><d><![CDATA[<raw>]]></d></a>`)
+	want := "<a x=\"1\">\n  <!-- c -->\n  <b>text <i>mixed</i>\n  </b>\n  <c/>\n  <d><![CDATA[<raw>]]></d>\n</a>\n"
+
+	indented, err := Indent(XML, content)
+
+	if err != nil {
+		t.Fatalf("Indent() error = %v", err)
+	}
+
+	if string(indented) != want {
+		t.Errorf("Indent() = %q, want %q", indented, want)
+	}
+}
+
+func TestXMLInvalid(t *testing.T) {
+	tests := []string{
+		`<a><b></a>`,
+		`<a>&unknown;</a>`,
+		`<a>`,
+	}
+
+	for _, content := range tests {
+		if err := Validate(XML, []byte(content)); err == nil {
+			t.Errorf("Validate(%q) = nil, want an error", content)
+		}
+
+		if pretty := Pretty(XML, []byte(content)); string(pretty) != content {
+			t.Errorf("Pretty(%q) = %q, want the content unchanged", content, pretty)
+		}
+	}
+}
@@ -3,6 +3,7 @@ module github.com/sn-edit/sn-edit
 go 1.14
 
 require (
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-resty/resty/v2 v2.2.0
 	github.com/icza/dyno v0.0.0-20200205103839-49cb13720835
 	github.com/kennygrant/sanitize v1.2.4
@@ -12,4 +13,5 @@ require (
 	github.com/sirupsen/logrus v1.2.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.4.0
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"sync"
+)
+
+// Task is one unit of work of a bulk operation (for example downloading one entry)
+type Task struct {
+	Name string
+	Run  func() error
+}
+
+// Result holds the outcome of one task
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Report collects the results of every task of a bulk operation
+type Report struct {
+	Succeeded []string
+	Failed    []Result
+}
+
+// Run executes the tasks with at most concurrency tasks running at the same time.
+// A failing task does not stop the others, every error is collected in the report.
+// After the context is cancelled the remaining tasks are not started and fail with its error.
+func Run(ctx context.Context, concurrency int, tasks []Task) Report {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]Result, len(tasks))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for index := range queue {
+				if ctx.Err() != nil {
+					results[index] = Result{Name: tasks[index].Name, Err: ctx.Err()}
+					continue
+				}
+
+				results[index] = Result{Name: tasks[index].Name, Err: tasks[index].Run()}
+			}
+		}()
+	}
+
+	for index := range tasks {
+		queue <- index
+	}
+
+	close(queue)
+	wg.Wait()
+
+	report := Report{Succeeded: []string{}, Failed: []Result{}}
+
+	// keep the order of the tasks in the report
+	for _, result := range results {
+		if result.Err != nil {
+			report.Failed = append(report.Failed, result)
+		} else {
+			report.Succeeded = append(report.Succeeded, result.Name)
+		}
+	}
+
+	return report
+}
+
+// Merge appends the results of another report
+func (r *Report) Merge(other Report) {
+	r.Succeeded = append(r.Succeeded, other.Succeeded...)
+	r.Failed = append(r.Failed, other.Failed...)
+}
+
+// Errors returns the error message of every failed task by its name
+func (r Report) Errors() map[string]string {
+	errors := map[string]string{}
+
+	for _, result := range r.Failed {
+		errors[result.Name] = result.Err.Error()
+	}
+
+	return errors
+}
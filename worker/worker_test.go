@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunConcurrency(t *testing.T) {
+	for _, concurrency := range []int{-1, 0, 1, 3, 20} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			var running, maxRunning, started int32
+			tasks := []Task{}
+
+			for i := 0; i < 10; i++ {
+				tasks = append(tasks, Task{Name: fmt.Sprintf("task-%d", i), Run: func() error {
+					atomic.AddInt32(&started, 1)
+					current := atomic.AddInt32(&running, 1)
+
+					for {
+						max := atomic.LoadInt32(&maxRunning)
+
+						if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+							break
+						}
+					}
+
+					// give the other workers the time to start their tasks
+					time.Sleep(10 * time.Millisecond)
+					atomic.AddInt32(&running, -1)
+
+					return nil
+				}})
+			}
+
+			report := Run(context.Background(), concurrency, tasks)
+
+			limit := int32(concurrency)
+
+			if limit < 1 {
+				limit = 1
+			}
+
+			if limit > int32(len(tasks)) {
+				limit = int32(len(tasks))
+			}
+
+			if got := atomic.LoadInt32(&maxRunning); got > limit {
+				t.Errorf("Run() ran %d tasks at once, want at most %d", got, limit)
+			}
+
+			// the limit is used, not only one task at a time
+			if got := atomic.LoadInt32(&maxRunning); limit > 1 && got < 2 {
+				t.Errorf("Run() ran %d tasks at once, want more than one", got)
+			}
+
+			if started != int32(len(tasks)) || len(report.Succeeded) != len(tasks) || len(report.Failed) != 0 {
+				t.Errorf("Run() started %d tasks and reported %d succeeded and %d failed, want %d succeeded", started, len(report.Succeeded), len(report.Failed), len(tasks))
+			}
+		})
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	tasks := []Task{}
+
+	for i := 0; i < 6; i++ {
+		i := i
+
+		tasks = append(tasks, Task{Name: fmt.Sprintf("task-%d", i), Run: func() error {
+			if i%2 == 1 {
+				return fmt.Errorf("error-%d", i)
+			}
+
+			return nil
+		}})
+	}
+
+	report := Run(context.Background(), 3, tasks)
+
+	if want := []string{"task-0", "task-2", "task-4"}; !reflect.DeepEqual(report.Succeeded, want) {
+		t.Errorf("Run() succeeded = %v, want %v", report.Succeeded, want)
+	}
+
+	want := map[string]string{"task-1": "error-1", "task-3": "error-3", "task-5": "error-5"}
+
+	if got := report.Errors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Report.Errors() = %v, want %v", got, want)
+	}
+
+	// the failures are kept in the order of the tasks
+	for i, result := range report.Failed {
+		if name := fmt.Sprintf("task-%d", 2*i+1); result.Name != name {
+			t.Errorf("Run() failed[%d] = %s, want %s", i, result.Name, name)
+		}
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var started int32
+	tasks := []Task{}
+
+	for i := 0; i < 10; i++ {
+		i := i
+
+		tasks = append(tasks, Task{Name: fmt.Sprintf("task-%d", i), Run: func() error {
+			atomic.AddInt32(&started, 1)
+
+			// the third task cancels the operation, the running tasks finish
+			if i == 2 {
+				cancel()
+			}
+
+			return nil
+		}})
+	}
+
+	report := Run(ctx, 1, tasks)
+
+	if want := []string{"task-0", "task-1", "task-2"}; !reflect.DeepEqual(report.Succeeded, want) {
+		t.Errorf("Run() succeeded = %v, want %v", report.Succeeded, want)
+	}
+
+	if started != 3 {
+		t.Errorf("Run() started %d tasks, want 3", started)
+	}
+
+	if len(report.Failed) != 7 {
+		t.Fatalf("Run() failed %d tasks, want 7", len(report.Failed))
+	}
+
+	for i, result := range report.Failed {
+		if name := fmt.Sprintf("task-%d", i+3); result.Name != name || !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("Run() failed[%d] = %s, %v, want %s, %v", i, result.Name, result.Err, name, context.Canceled)
+		}
+	}
+}
+
+func TestReportMerge(t *testing.T) {
+	report := Report{}
+	report.Merge(Report{Succeeded: []string{"a"}, Failed: []Result{{Name: "b", Err: errors.New("error-b")}}})
+	report.Merge(Report{Succeeded: []string{"c"}, Failed: []Result{{Name: "d", Err: errors.New("error-d")}}})
+
+	if want := []string{"a", "c"}; !reflect.DeepEqual(report.Succeeded, want) {
+		t.Errorf("Report.Merge() succeeded = %v, want %v", report.Succeeded, want)
+	}
+
+	if want := map[string]string{"b": "error-b", "d": "error-d"}; !reflect.DeepEqual(report.Errors(), want) {
+		t.Errorf("Report.Errors() = %v, want %v", report.Errors(), want)
+	}
+}